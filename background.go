@@ -0,0 +1,71 @@
+package icalcache
+
+import (
+	"context"
+	"time"
+)
+
+// background is the goroutine of Start.
+type background struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Start spawns a goroutine which refreshes the cache whenever Get would check upstream, so Get usually returns from memory. Get and the goroutine share the same schedule, so they don't fetch twice. The goroutine ends if ctx is done or Stop is called, then Start can be called again. Calling Start again while it is running has no effect.
+func (cache *Cache) Start(ctx context.Context, defaultLocation *time.Location) {
+	defaultLocation = cache.defaultLocation(defaultLocation)
+	cache.stopLock.Lock()
+	defer cache.stopLock.Unlock()
+	if cache.background != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	b := &background{cancel, make(chan struct{})}
+	cache.background = b
+	go cache.run(ctx, defaultLocation, b)
+}
+
+func (cache *Cache) run(ctx context.Context, defaultLocation *time.Location, b *background) {
+	defer func() {
+		cache.stopLock.Lock()
+		if cache.background == b { // not stopped or restarted meanwhile
+			cache.background = nil
+		}
+		cache.stopLock.Unlock()
+		b.cancel()
+		close(b.done)
+	}()
+	for {
+		cache.GetContext(ctx, defaultLocation) // on error, Get keeps returning the cached events
+
+		cache.lock.Lock()
+		wait := cache.nextCheck().Sub(cache.now())
+		if wait <= 0 { // GetContext failed before checking upstream, or AlwaysCheck, don't spin
+			wait = cache.interval()
+			if wait <= 0 {
+				wait = DefaultInterval
+			}
+		}
+		cache.lock.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Stop stops the goroutine started by Start. It cancels a running fetch and waits until it has returned.
+func (cache *Cache) Stop() {
+	cache.stopLock.Lock()
+	b := cache.background
+	cache.background = nil
+	cache.stopLock.Unlock()
+	if b != nil {
+		b.cancel()
+		<-b.done
+	}
+}
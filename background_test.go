@@ -0,0 +1,69 @@
+package icalcache
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStartAfterContextDone(t *testing.T) {
+	body := testCalendar("a")
+	server, requests := calendarServer(t, &body)
+	cache := &Cache{Config: Config{URL: server.URL}}
+	clock := newFakeClock()
+	cache.SetClock(clock.Now)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cache.Start(ctx, nil)
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		cache.stopLock.Lock()
+		running := cache.background != nil
+		cache.stopLock.Unlock()
+		if !running {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("goroutine has not ended")
+		}
+	}
+
+	clock.Advance(time.Hour) // the canceled call has counted as a check
+	cache.Start(context.Background(), nil)
+	defer cache.Stop()
+	for deadline := time.Now().Add(time.Second); requests.Load() == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("second Start has no effect")
+		}
+	}
+}
+
+func TestStopCancelsFetch(t *testing.T) {
+	arrived := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+			io.WriteString(w, testCalendar("a"))
+		}
+	}))
+	defer server.Close()
+	cache := &Cache{Config: Config{URL: server.URL}}
+	cache.Start(context.Background(), nil)
+	<-arrived
+
+	stopped := make(chan struct{})
+	go func() {
+		cache.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stop waits for the fetch instead of canceling it")
+	}
+}
@@ -0,0 +1,28 @@
+package icalcache
+
+import "time"
+
+// DefaultBreakerThreshold is used if Cache.BreakerThreshold is zero.
+const DefaultBreakerThreshold = 5
+
+// DefaultBreakerCooldown is used if Cache.BreakerCooldown is zero.
+const DefaultBreakerCooldown = 5 * time.Minute
+
+// circuitOpen reports whether so many consecutive refreshes have failed that upstream is left alone for BreakerCooldown. The caller must hold the lock.
+func (cache *Cache) circuitOpen() bool {
+	threshold := cache.BreakerThreshold
+	switch {
+	case threshold < 0:
+		return false
+	case threshold == 0:
+		threshold = DefaultBreakerThreshold
+	}
+	return cache.failures >= threshold
+}
+
+func (cache *Cache) breakerCooldown() time.Duration {
+	if cache.BreakerCooldown > 0 {
+		return cache.BreakerCooldown
+	}
+	return DefaultBreakerCooldown
+}
@@ -0,0 +1,97 @@
+package icalcache
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var failing atomic.Bool
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, testCalendar("a"))
+	}))
+	defer server.Close()
+	clock := newFakeClock()
+	cache := &Cache{Config: Config{URL: server.URL}, Retries: -1, ErrorInterval: time.Minute, BreakerThreshold: 3, BreakerCooldown: 10 * time.Minute}
+	cache.SetClock(clock.Now)
+	mustGet(t, cache)
+
+	failing.Store(true)
+	clock.Advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		if cache.Stats().CircuitOpen {
+			t.Fatalf("circuit open after %d failures", i)
+		}
+		cache.Get(time.UTC)
+		clock.Advance(time.Minute)
+	}
+	if !cache.Stats().CircuitOpen {
+		t.Fatal("circuit not open after 3 failures")
+	}
+	if got := requests.Load(); got != 4 {
+		t.Fatalf("got %d requests", got)
+	}
+
+	// the cached events are returned without checking upstream during the cooldown
+	clock.Advance(8 * time.Minute)
+	if events, _, err := cache.Get(time.UTC); err != nil || len(events) != 1 {
+		t.Fatalf("got %v, %v during the cooldown", events, err)
+	}
+	if got := requests.Load(); got != 4 {
+		t.Fatalf("got %d requests during the cooldown", got)
+	}
+
+	failing.Store(false)
+	clock.Advance(2 * time.Minute)
+	mustGet(t, cache)
+	if got := requests.Load(); got != 5 {
+		t.Fatalf("got %d requests after the cooldown", got)
+	}
+	if cache.Stats().CircuitOpen {
+		t.Fatal("circuit still open after a successful refresh")
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	clock := newFakeClock()
+	cache := &Cache{Config: Config{URL: server.URL}, Retries: -1, ErrorInterval: time.Minute, BreakerThreshold: -1}
+	cache.SetClock(clock.Now)
+	for range 10 {
+		cache.Get(time.UTC)
+		clock.Advance(time.Minute)
+	}
+	if cache.Stats().CircuitOpen || requests.Load() != 10 {
+		t.Fatalf("got %d requests, circuit open %v", requests.Load(), cache.Stats().CircuitOpen)
+	}
+}
+
+func TestCircuitBreakerForceRefresh(t *testing.T) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	cache := &Cache{Config: Config{URL: server.URL}, Retries: -1, BreakerThreshold: 1}
+	cache.Get(time.UTC)
+	cache.ForceRefresh(time.UTC)
+	if requests.Load() != 2 {
+		t.Fatalf("got %d requests, ForceRefresh must ignore the open circuit", requests.Load())
+	}
+}
@@ -0,0 +1,326 @@
+package icalcache
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Defaults for Cache.CalDAVPast and Cache.CalDAVFuture
+const (
+	DefaultCalDAVPast   = 30 * 24 * time.Hour
+	DefaultCalDAVFuture = 365 * 24 * time.Hour
+)
+
+const propfindCTag = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:" xmlns:cs="http://calendarserver.org/ns/">
+  <d:prop><cs:getctag/></d:prop>
+</d:propfind>`
+
+const calendarQuery = `<?xml version="1.0" encoding="utf-8"?>
+<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><c:calendar-data/></d:prop>
+  <c:filter>
+    <c:comp-filter name="VCALENDAR">
+      <c:comp-filter name="VEVENT">
+        <c:time-range start="%s" end="%s"/>
+      </c:comp-filter>
+    </c:comp-filter>
+  </c:filter>
+</c:calendar-query>`
+
+const syncCollection = `<?xml version="1.0" encoding="utf-8"?>
+<d:sync-collection xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:sync-token>%s</d:sync-token>
+  <d:sync-level>1</d:sync-level>
+  <d:prop><d:getetag/><c:calendar-data/></d:prop>
+</d:sync-collection>`
+
+const calendarMultiget = `<?xml version="1.0" encoding="utf-8"?>
+<c:calendar-multiget xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:getetag/><c:calendar-data/></d:prop>
+%s</c:calendar-multiget>`
+
+// multistatus is the body of a 207 Multi-Status response, reduced to the properties we request.
+type multistatus struct {
+	SyncToken string     `xml:"DAV: sync-token"`
+	Responses []response `xml:"DAV: response"`
+}
+
+type response struct {
+	Href      string `xml:"DAV: href"`
+	Status    string `xml:"DAV: status"` // like "HTTP/1.1 404 Not Found" for a resource which has been deleted since the sync token
+	Propstats []struct {
+		Status string `xml:"DAV: status"`
+		Prop   struct {
+			CTag         string `xml:"http://calendarserver.org/ns/ getctag"`
+			CalendarData string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+		} `xml:"DAV: prop"`
+	} `xml:"DAV: propstat"`
+}
+
+// calendarData returns the calendar-data property of a multistatus response.
+func (resp response) calendarData() string {
+	for _, propstat := range resp.Propstats {
+		if propstat.Prop.CalendarData != "" {
+			return propstat.Prop.CalendarData
+		}
+	}
+	return ""
+}
+
+func (cache *Cache) calDAVPast() time.Duration {
+	if cache.CalDAVPast > 0 {
+		return cache.CalDAVPast
+	}
+	return DefaultCalDAVPast
+}
+
+func (cache *Cache) calDAVFuture() time.Duration {
+	if cache.CalDAVFuture > 0 {
+		return cache.CalDAVFuture
+	}
+	return DefaultCalDAVFuture
+}
+
+// fetchCalDAV gets the events of a CalDAV collection. The caller must hold the lock.
+func (cache *Cache) fetchCalDAV(ctx context.Context) (io.ReadCloser, time.Time, bool, error) {
+	return cache.fetchMirrors(ctx, cache.fetchCalDAVUpstream)
+}
+
+// fetchCalDAVUpstream skips the query if the CTag of the collection is unchanged, so the time range moves on only if the collection changes. Both requests get GetTimeout. The calendar data of all responses is merged into one VCALENDAR.
+func (cache *Cache) fetchCalDAVUpstream(ctx context.Context, rawURL string) (io.ReadCloser, time.Time, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, cache.getTimeout())
+	defer cancel()
+
+	if cache.CalDAVSync {
+		return cache.syncCalDAV(ctx, rawURL)
+	}
+
+	// PROPFIND the CTag, servers without CTag support are queried every time
+	ms, err := cache.davRequest(ctx, "PROPFIND", rawURL, "0", propfindCTag)
+	if err != nil {
+		return nil, time.Time{}, false, fmt.Errorf("getting caldav ctag: %w", err)
+	}
+	var ctag string
+	for _, resp := range ms.Responses {
+		for _, propstat := range resp.Propstats {
+			if propstat.Prop.CTag != "" {
+				ctag = propstat.Prop.CTag
+			}
+		}
+	}
+	if ctag != "" && ctag == cache.lastCTag {
+		return nil, time.Time{}, true, nil
+	}
+
+	// REPORT calendar-query
+	now := cache.now().UTC()
+	const icalUTC = "20060102T150405Z"
+	query := fmt.Sprintf(calendarQuery, now.Add(-cache.calDAVPast()).Format(icalUTC), now.Add(cache.calDAVFuture()).Format(icalUTC))
+	ms, err = cache.davRequest(ctx, "REPORT", rawURL, "1", query)
+	if err != nil {
+		return nil, time.Time{}, false, fmt.Errorf("querying caldav collection: %w", err)
+	}
+	resources := make(map[string]string)
+	for _, resp := range ms.Responses {
+		resources[resp.Href] = resp.calendarData()
+	}
+	body, err := mergeResources(resources)
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+
+	cache.lastCTag = ctag
+	return body, time.Time{}, false, nil
+}
+
+// syncCalDAV downloads the changes since the last sync token and merges them into the stored calendar data. If upstream rejects the token, it falls back to a full sync. The caller must hold the lock.
+func (cache *Cache) syncCalDAV(ctx context.Context, rawURL string) (io.ReadCloser, time.Time, bool, error) {
+	if cache.syncURL != rawURL {
+		cache.syncToken = ""
+		cache.syncResources = nil
+		cache.syncURL = rawURL
+	}
+	incremental := cache.syncToken != ""
+	ms, err := cache.davRequest(ctx, "REPORT", rawURL, "0", fmt.Sprintf(syncCollection, escapeXML(cache.syncToken)))
+	var statusErr StatusError
+	if incremental && errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusBadRequest, http.StatusForbidden, http.StatusConflict: // invalid or expired sync token, RFC 6578 section 3.2
+			incremental = false
+			ms, err = cache.davRequest(ctx, "REPORT", rawURL, "0", fmt.Sprintf(syncCollection, ""))
+		}
+	}
+	if err != nil {
+		return nil, time.Time{}, false, fmt.Errorf("syncing caldav collection: %w", err)
+	}
+
+	resources := make(map[string]string)
+	if incremental {
+		resources = maps.Clone(cache.syncResources)
+	}
+	var changed bool
+	var missing []string // servers may omit calendar-data in sync-collection responses
+	for _, resp := range ms.Responses {
+		if strings.HasSuffix(resp.Href, "/") { // the collection itself
+			continue
+		}
+		changed = true
+		if strings.Contains(resp.Status, " 404 ") {
+			delete(resources, resp.Href)
+			continue
+		}
+		if data := resp.calendarData(); data != "" {
+			resources[resp.Href] = data
+		} else {
+			missing = append(missing, resp.Href)
+		}
+	}
+	if len(missing) > 0 {
+		var hrefs strings.Builder
+		for _, href := range missing {
+			fmt.Fprintf(&hrefs, "  <d:href>%s</d:href>\n", escapeXML(href))
+		}
+		got, err := cache.davRequest(ctx, "REPORT", rawURL, "1", fmt.Sprintf(calendarMultiget, hrefs.String()))
+		if err != nil {
+			return nil, time.Time{}, false, fmt.Errorf("getting changed caldav resources: %w", err)
+		}
+		for _, resp := range got.Responses {
+			if data := resp.calendarData(); data != "" {
+				resources[resp.Href] = data
+			}
+		}
+	}
+
+	var body io.ReadCloser
+	if !incremental || changed {
+		body, err = mergeResources(resources)
+		if err != nil {
+			return nil, time.Time{}, false, err
+		}
+	}
+	cache.syncToken = ms.SyncToken
+	cache.syncResources = resources
+	cache.lastSyncIncremental = incremental
+	return body, time.Time{}, body == nil, nil
+}
+
+// IncrementalSync reports whether the last CalDAV sync downloaded only the changes since the previous one, see Config.CalDAVSync.
+func (cache *Cache) IncrementalSync() bool {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	return cache.lastSyncIncremental
+}
+
+// mergeResources merges the calendar data of CalDAV resources into one VCALENDAR, ordered by href.
+func mergeResources(resources map[string]string) (io.ReadCloser, error) {
+	var merged strings.Builder
+	merged.WriteString("BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//go-ical-cache//CalDAV//EN\r\n")
+	for _, href := range slices.Sorted(maps.Keys(resources)) {
+		if err := writeComponents(&merged, resources[href]); err != nil {
+			return nil, fmt.Errorf("reading calendar data of %s: %w", href, err)
+		}
+	}
+	merged.WriteString("END:VCALENDAR\r\n")
+	return io.NopCloser(strings.NewReader(merged.String())), nil
+}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// davRequest sends a WebDAV request with an XML body and decodes the multistatus response.
+func (cache *Cache) davRequest(ctx context.Context, method, rawURL, depth, body string) (multistatus, error) {
+	ctx, span := cache.startSpan(ctx, "icalcache."+method)
+	ms, err := cache.davRoundTrip(ctx, method, rawURL, depth, body)
+	span.End(err)
+	return ms, err
+}
+
+func (cache *Cache) davRoundTrip(ctx context.Context, method, rawURL, depth, body string) (multistatus, error) {
+	req, err := cache.newRequest(ctx, method, rawURL, strings.NewReader(body))
+	if err != nil {
+		return multistatus{}, fmt.Errorf("making upstream request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	req.Header.Set("Depth", depth)
+	info := RequestInfo{Method: req.Method, URL: req.URL.Redacted()}
+	start := time.Now()
+	resp, err := cache.do(req)
+	if err != nil {
+		cache.report(info, start, err)
+		return multistatus{}, err
+	}
+	defer closeBody(resp.Body)
+	info.StatusCode = resp.StatusCode
+	if err := cache.checkStatus(resp); err != nil {
+		cache.report(info, start, err)
+		return multistatus{}, err
+	}
+	ms, err := readMultistatus(resp, cache.maxBodyBytes())
+	cache.report(info, start, err)
+	return ms, err
+}
+
+// readMultistatus decodes the body of a 207 Multi-Status response.
+func readMultistatus(resp *http.Response, maxBodyBytes int64) (multistatus, error) {
+	if resp.StatusCode != http.StatusMultiStatus {
+		return multistatus{}, fmt.Errorf("upstream returned %s instead of 207 Multi-Status", resp.Status)
+	}
+	var ms multistatus
+	limited := &limitReader{r: resp.Body, max: maxBodyBytes}
+	err := xml.NewDecoder(limited).Decode(&ms)
+	if limited.exceeded {
+		return multistatus{}, BodyTooLargeError{limited.max}
+	}
+	if err != nil {
+		return multistatus{}, fmt.Errorf("decoding multistatus: %w", err)
+	}
+	return ms, nil
+}
+
+// writeComponents copies the components (like VEVENT and VTIMEZONE) of a VCALENDAR to w, without the calendar properties.
+func writeComponents(w io.Writer, calendarData string) error {
+	if strings.TrimSpace(calendarData) == "" {
+		return nil
+	}
+	var depth int
+	scanner := bufio.NewScanner(strings.NewReader(calendarData))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		upper := strings.ToUpper(line)
+		if strings.HasPrefix(upper, "BEGIN:") {
+			depth++
+		}
+		if depth >= 2 {
+			if _, err := io.WriteString(w, line+"\r\n"); err != nil {
+				return err
+			}
+		}
+		if strings.HasPrefix(upper, "END:") {
+			depth--
+		}
+		if depth < 0 {
+			return errors.New("unbalanced END line")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if depth != 0 {
+		return errors.New("unbalanced BEGIN line")
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package icalcache
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncServer is a CalDAV collection which supports sync-collection reports. Tokens are the number of changes.
+type syncServer struct {
+	sync.Mutex
+	resources map[string]string // uid by href
+	deleted   map[string]int    // token of the deletion by href
+	changed   map[string]int    // token of the last change by href
+	token     int
+	expired   bool // reject all tokens
+	omitData  bool // omit calendar-data, so the client has to multiget
+	multigets int
+}
+
+var syncTokenPattern = regexp.MustCompile(`<d:sync-token>(.*)</d:sync-token>`)
+
+func (s *syncServer) set(href, uid string) {
+	s.Lock()
+	defer s.Unlock()
+	s.token++
+	if uid == "" {
+		delete(s.resources, href)
+		s.deleted[href] = s.token
+	} else {
+		s.resources[href] = uid
+		delete(s.deleted, href)
+	}
+	s.changed[href] = s.token
+}
+
+func (s *syncServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0"?><d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">`)
+	writeResource := func(href string, data bool) {
+		fmt.Fprintf(&b, `<d:response><d:href>%s</d:href><d:propstat><d:prop><d:getetag>"1"</d:getetag>`, href)
+		if data {
+			b.WriteString("<c:calendar-data>")
+			xml.EscapeText(&b, []byte(testCalendar(s.resources[href])))
+			b.WriteString("</c:calendar-data>")
+		}
+		b.WriteString(`</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`)
+	}
+
+	if strings.Contains(string(body), "calendar-multiget") {
+		s.multigets++
+		for _, match := range regexp.MustCompile(`<d:href>(.*)</d:href>`).FindAllStringSubmatch(string(body), -1) {
+			writeResource(match[1], true)
+		}
+	} else {
+		since := 0
+		if token := syncTokenPattern.FindStringSubmatch(string(body))[1]; token != "" {
+			if s.expired {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Sscan(token, &since)
+		}
+		for _, href := range slices.Sorted(maps.Keys(s.changed)) {
+			switch {
+			case s.changed[href] <= since:
+			case s.deleted[href] > 0:
+				if since > 0 {
+					fmt.Fprintf(&b, `<d:response><d:href>%s</d:href><d:status>HTTP/1.1 404 Not Found</d:status></d:response>`, href)
+				}
+			default:
+				writeResource(href, !s.omitData)
+			}
+		}
+		fmt.Fprintf(&b, `<d:sync-token>%d</d:sync-token>`, s.token)
+	}
+	b.WriteString(`</d:multistatus>`)
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, b.String())
+}
+
+func TestCalDAVSync(t *testing.T) {
+	upstream := &syncServer{resources: map[string]string{}, deleted: map[string]int{}, changed: map[string]int{}}
+	server := httptest.NewServer(upstream)
+	defer server.Close()
+	upstream.set("/cal/1.ics", "a")
+	upstream.set("/cal/2.ics", "b")
+	cache := &Cache{Config: Config{URL: server.URL + "/cal/", Protocol: ProtocolCalDAV, CalDAVSync: true}}
+
+	check := func(wantUIDs string, wantIncremental bool) {
+		t.Helper()
+		events, _, err := cache.ForceRefresh(time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := uids(events)
+		slices.Sort(got)
+		if strings.Join(got, ",") != wantUIDs {
+			t.Fatalf("got %v, want %s", got, wantUIDs)
+		}
+		if cache.IncrementalSync() != wantIncremental {
+			t.Fatalf("got incremental %v", cache.IncrementalSync())
+		}
+	}
+	check("a,b", false)
+	upstream.set("/cal/2.ics", "")
+	upstream.set("/cal/3.ics", "c")
+	check("a,c", true)
+	check("a,c", true) // no changes
+
+	upstream.omitData = true
+	upstream.set("/cal/1.ics", "d")
+	check("c,d", true)
+	if upstream.multigets != 1 {
+		t.Fatalf("got %d multigets, want 1", upstream.multigets)
+	}
+
+	upstream.expired = true
+	upstream.omitData = false
+	upstream.set("/cal/4.ics", "e")
+	check("c,d,e", false) // full sync after the token has been rejected
+}
+
+// queryServer is a CalDAV collection which answers PROPFIND with its CTag and calendar-query reports with one resource per uid. It records the requests.
+type queryServer struct {
+	sync.Mutex
+	ctag     string // empty if not supported
+	uids     []string
+	requests []string // method, depth and time range
+}
+
+var timeRangePattern = regexp.MustCompile(`<c:time-range start="(.*)" end="(.*)"/>`)
+
+func (s *queryServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0"?><d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav" xmlns:cs="http://calendarserver.org/ns/">`)
+	switch r.Method {
+	case "PROPFIND":
+		s.requests = append(s.requests, "PROPFIND "+r.Header.Get("Depth"))
+		b.WriteString(`<d:response><d:href>/cal/</d:href><d:propstat><d:prop>`)
+		if s.ctag != "" {
+			fmt.Fprintf(&b, `<cs:getctag>%s</cs:getctag>`, s.ctag)
+		}
+		b.WriteString(`</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`)
+	case "REPORT":
+		timeRange := timeRangePattern.FindStringSubmatch(string(body))
+		s.requests = append(s.requests, "REPORT "+r.Header.Get("Depth")+" "+timeRange[1]+" "+timeRange[2])
+		for _, uid := range s.uids {
+			fmt.Fprintf(&b, `<d:response><d:href>/cal/%s.ics</d:href><d:propstat><d:prop><c:calendar-data>`, uid)
+			xml.EscapeText(&b, []byte(testCalendar(uid)))
+			b.WriteString(`</c:calendar-data></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	b.WriteString(`</d:multistatus>`)
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, b.String())
+}
+
+func (s *queryServer) update(ctag string, uids ...string) []string {
+	s.Lock()
+	defer s.Unlock()
+	s.ctag, s.uids = ctag, uids
+	requests := s.requests
+	s.requests = nil
+	return requests
+}
+
+func TestCalDAVQuery(t *testing.T) {
+	server := &queryServer{ctag: "1", uids: []string{"a", "b"}}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	clock := newFakeClock()
+	cache := &Cache{Config: Config{URL: httpServer.URL + "/cal/", Protocol: ProtocolCalDAV}, CalDAVPast: 24 * time.Hour, CalDAVFuture: 48 * time.Hour}
+	cache.SetClock(clock.Now)
+
+	if got := uids(mustGet(t, cache)); !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("got %v", got)
+	}
+	want := []string{"PROPFIND 0", "REPORT 1 20231231T120000Z 20240103T120000Z"}
+	if got := server.update("1", "c"); !slices.Equal(got, want) {
+		t.Fatalf("got requests %q, want %q", got, want)
+	}
+
+	// unchanged CTag
+	clock.Advance(time.Hour)
+	if _, _, err := cache.ForceRefresh(time.UTC); err != nil {
+		t.Fatal(err)
+	}
+	if got := uids(mustGet(t, cache)); !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("got %v with unchanged ctag", got)
+	}
+	if got := server.update("2", "c"); !slices.Equal(got, []string{"PROPFIND 0"}) {
+		t.Fatalf("got requests %q with unchanged ctag", got)
+	}
+
+	// changed CTag
+	if events, _, err := cache.ForceRefresh(time.UTC); err != nil || !slices.Equal(uids(events), []string{"c"}) {
+		t.Fatalf("got %v, %v with changed ctag", events, err)
+	}
+	want = []string{"PROPFIND 0", "REPORT 1 20231231T130000Z 20240103T130000Z"}
+	if got := server.update("", "d"); !slices.Equal(got, want) {
+		t.Fatalf("got requests %q, want %q", got, want)
+	}
+
+	// no CTag support
+	for i := 0; i < 2; i++ {
+		if events, _, err := cache.ForceRefresh(time.UTC); err != nil || !slices.Equal(uids(events), []string{"d"}) {
+			t.Fatalf("got %v, %v without ctag", events, err)
+		}
+	}
+	if got := server.update(""); len(got) != 4 || got[3][:6] != "REPORT" {
+		t.Fatalf("got requests %q without ctag, want a query per refresh", got)
+	}
+}
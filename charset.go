@@ -0,0 +1,32 @@
+package icalcache
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/transform"
+)
+
+// transcode converts body to UTF-8 according to the charset parameter of contentType. Without charset parameter, body is returned unchanged.
+func transcode(body io.ReadCloser, contentType string) (io.ReadCloser, error) {
+	if contentType == "" {
+		return body, nil
+	}
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return body, nil // malformed content types are ignored, like missing ones
+	}
+	charset := strings.ToLower(strings.TrimSpace(params["charset"]))
+	switch charset {
+	case "", "utf-8", "utf8", "us-ascii":
+		return body, nil
+	}
+	encoding, err := ianaindex.MIME.Encoding(charset)
+	if err != nil || encoding == nil {
+		return nil, fmt.Errorf("unsupported charset: %s", charset)
+	}
+	return readCloser{transform.NewReader(body, encoding.NewDecoder()), body}, nil
+}
@@ -0,0 +1,46 @@
+package icalcache
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCharset(t *testing.T) {
+	latin1 := strings.Replace(testCalendar("a"), "SUMMARY:Event a", "SUMMARY:Caf\xe9", 1)
+	tests := []struct {
+		contentType string
+		summary     string
+		ok          bool
+	}{
+		{"text/calendar; charset=ISO-8859-1", "Café", true},
+		{`text/calendar; charset="latin1"`, "Café", true},
+		{"text/calendar; charset=utf-8", "Event a", true},
+		{"text/calendar", "Event a", true},
+		{"text/calendar; charset=x-unknown", "", false},
+	}
+	for _, test := range tests {
+		body := latin1
+		if test.summary == "Event a" {
+			body = testCalendar("a")
+		}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", test.contentType)
+			io.WriteString(w, body)
+		}))
+		events, _, err := (&Cache{Config: Config{URL: server.URL}, Retries: -1}).Get(time.UTC)
+		server.Close()
+		if !test.ok {
+			if err == nil || !strings.Contains(err.Error(), "unsupported charset") {
+				t.Fatalf("%s: got %v, want an unsupported charset error", test.contentType, err)
+			}
+			continue
+		}
+		if err != nil || len(events) != 1 || events[0].Summary != test.summary {
+			t.Fatalf("%s: got %v, %v, want summary %q", test.contentType, events, err, test.summary)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package icalcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+var errStopDecoding = errors.New("stop decoding")
+
+// Check requests the first URL and reports whether it is reachable, accepts the credentials and serves iCalendar data. The body is read up to the first event only. Check does not modify the cached events, validators and timestamps, and does not count as a refresh. The lock is released during the request, so Get is not blocked, and a Fetcher may be called concurrently with a refresh. The error can be examined with errors.Is and errors.As, for example for *net.DNSError, *tls.CertificateVerificationError, ProxyError, ErrUnauthorized, StatusError, ErrNotICalendar or BodyTooLargeError.
+func (cache *Cache) Check(ctx context.Context) error {
+	cache.lock.Lock()
+	ctx, cancel := context.WithTimeout(ctx, cache.getTimeout())
+	defer cancel()
+	probe, err := cache.probe(ctx)
+	maxBodyBytes := cache.maxBodyBytes()
+	cache.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	body, err := probe()
+	if err != nil || body == nil {
+		return err
+	}
+	defer body.Close()
+
+	limited := &limitReader{r: body, max: maxBodyBytes}
+	err = decodeEvents(limited, func(ical.Event) error {
+		return errStopDecoding
+	})
+	switch {
+	case limited.exceeded:
+		return BodyTooLargeError{limited.max}
+	case err == nil, err == io.EOF, err == errStopDecoding:
+		return nil
+	default:
+		return fmt.Errorf("decoding upstream ical data: %w", err)
+	}
+}
+
+// probe prepares the request of Check. The returned function does not access the cache, so it can be called without holding the lock. It returns a nil body if there is nothing to decode. The caller must hold the lock.
+func (cache *Cache) probe(ctx context.Context) (func() (io.ReadCloser, error), error) {
+	if cache.Fetcher != nil {
+		fetcher := cache.Fetcher
+		return func() (io.ReadCloser, error) {
+			body, _, notModified, err := fetcher.Fetch(ctx)
+			if err == nil && notModified {
+				return nil, nil
+			}
+			return body, err
+		}, nil
+	}
+	urls := cache.urls()
+	if len(urls) == 0 {
+		return nil, errors.New("no url configured")
+	}
+	if path, ok := filePath(urls[0]); ok {
+		if cache.BlockPrivateAddresses {
+			return nil, errors.New("file urls are blocked")
+		}
+		return func() (io.ReadCloser, error) {
+			body, _, _, err := fetchFile(path)
+			return body, err
+		}, nil
+	}
+
+	s, err := cache.sender()
+	if err != nil {
+		return nil, err
+	}
+	now := cache.now
+	if cache.Protocol == ProtocolCalDAV {
+		spanCtx, span := cache.startSpan(ctx, "icalcache.PROPFIND")
+		req, err := cache.newRequest(spanCtx, "PROPFIND", urls[0], strings.NewReader(propfindCTag))
+		if err != nil {
+			span.End(err)
+			return nil, fmt.Errorf("making upstream request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+		req.Header.Set("Depth", "0")
+		maxBodyBytes := cache.maxBodyBytes()
+		return func() (io.ReadCloser, error) {
+			err := propfind(s, req, now, maxBodyBytes)
+			span.End(err)
+			if err != nil {
+				return nil, fmt.Errorf("getting caldav ctag: %w", err)
+			}
+			return nil, nil
+		}, nil
+	}
+
+	req, err := cache.newRequest(ctx, http.MethodGet, urls[0], nil)
+	if err != nil {
+		return nil, fmt.Errorf("making upstream request: %w", err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	skipContentCheck := cache.SkipContentCheck
+	return func() (io.ReadCloser, error) {
+		resp, err := s.do(req)
+		if err != nil {
+			return nil, fmt.Errorf("getting upstream data: %w", err)
+		}
+		if err := checkStatus(resp, now()); err != nil {
+			closeBody(resp.Body)
+			return nil, fmt.Errorf("getting upstream data: %w", err)
+		}
+		return responseBody(resp, skipContentCheck)
+	}, nil
+}
+
+func propfind(s *sender, req *http.Request, now func() time.Time, maxBodyBytes int64) error {
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp.Body)
+	if err := checkStatus(resp, now()); err != nil {
+		return err
+	}
+	_, err = readMultistatus(resp, maxBodyBytes)
+	return err
+}
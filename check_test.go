@@ -0,0 +1,109 @@
+package icalcache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/calendar.ics":
+			io.WriteString(w, testCalendar("a", "b"))
+		case "/private.ics":
+			if _, _, ok := r.BasicAuth(); !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			io.WriteString(w, testCalendar("a"))
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, "<html>not a calendar</html>")
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		config Config
+		want   error
+	}{
+		{"valid", Config{URL: server.URL + "/calendar.ics"}, nil},
+		{"unauthorized", Config{URL: server.URL + "/private.ics"}, ErrUnauthorized},
+		{"authorized", Config{URL: server.URL + "/private.ics", Username: "user", Password: "secret"}, nil},
+		{"not icalendar", Config{URL: server.URL + "/index.html"}, ErrNotICalendar},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cache := &Cache{Config: test.config}
+			err := cache.Check(context.Background())
+			if test.want == nil && err != nil || test.want != nil && !errors.Is(err, test.want) {
+				t.Fatalf("got %v, want %v", err, test.want)
+			}
+			if cache.current.Load() != nil || !cache.lastChecked.IsZero() {
+				t.Fatal("Check has modified the cache")
+			}
+		})
+	}
+}
+
+func TestCheckFetcherOnly(t *testing.T) {
+	cache := &Cache{Fetcher: FetcherFunc(func(ctx context.Context) (io.ReadCloser, time.Time, bool, error) {
+		return io.NopCloser(strings.NewReader(testCalendar("a"))), time.Time{}, false, nil
+	})}
+	if err := cache.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	failing := &Cache{Fetcher: FetcherFunc(func(ctx context.Context) (io.ReadCloser, time.Time, bool, error) {
+		return nil, time.Time{}, false, errors.New("fetcher failed")
+	})}
+	if err := failing.Check(context.Background()); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestCheckNoURL(t *testing.T) {
+	if err := new(Cache).Check(context.Background()); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestCheckDoesNotBlock(t *testing.T) {
+	requested := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(requested)
+		<-release
+		io.WriteString(w, testCalendar("a"))
+	}))
+	defer server.Close()
+
+	cache := &Cache{Config: Config{URL: server.URL}}
+	checked := make(chan error)
+	go func() {
+		checked <- cache.Check(context.Background())
+	}()
+	<-requested
+
+	locked := make(chan struct{})
+	go func() {
+		cache.SetEvents(nil, time.Time{}) // takes the lock
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Check holds the lock during the request")
+	}
+	close(release)
+	if err := <-checked; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,201 @@
+package icalcache
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingServer serves "a" first, then blocks each request until release is closed and serves "b".
+func blockingServer(t *testing.T) (server *httptest.Server, blocked <-chan struct{}, release func()) {
+	var requests atomic.Int64
+	blockedCh := make(chan struct{}, 16)
+	releaseCh := make(chan struct{})
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			io.WriteString(w, testCalendar("a"))
+			return
+		}
+		blockedCh <- struct{}{}
+		<-releaseCh
+		io.WriteString(w, testCalendar("b"))
+	}))
+	var once sync.Once
+	release = func() { once.Do(func() { close(releaseCh) }) }
+	t.Cleanup(server.Close)
+	t.Cleanup(release) // before server.Close
+	return server, blockedCh, release
+}
+
+// getUID calls Get and returns the uid of the only event.
+func getUID(t *testing.T, cache *Cache) string {
+	events, _, err := cache.Get(time.UTC)
+	if err != nil || len(events) != 1 {
+		t.Errorf("got %v, %v", uids(events), err)
+		return ""
+	}
+	return events[0].UID
+}
+
+func TestGetDuringRefresh(t *testing.T) {
+	server, blocked, release := blockingServer(t)
+	clock := newFakeClock()
+	cache := &Cache{Config: Config{URL: server.URL}}
+	cache.SetClock(clock.Now)
+	mustGet(t, cache)
+	clock.Advance(time.Hour)
+
+	refreshed := make(chan struct{})
+	go func() {
+		defer close(refreshed)
+		cache.ForceRefresh(time.UTC)
+	}()
+	<-blocked
+
+	// concurrent calls don't wait for the refresh which holds the lock
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if uid := getUID(t, cache); uid != "a" {
+				t.Errorf("got %q during the refresh", uid)
+			}
+			cache.Metrics()
+			cache.Generation()
+		}()
+	}
+	wg.Wait()
+
+	release()
+	<-refreshed
+	if uid := getUID(t, cache); uid != "b" {
+		t.Fatalf("got %q after the refresh", uid)
+	}
+}
+
+func TestWaitForRefresh(t *testing.T) {
+	server, blocked, release := blockingServer(t)
+	clock := newFakeClock()
+	cache := &Cache{Config: Config{URL: server.URL}, WaitForRefresh: true}
+	cache.SetClock(clock.Now)
+	mustGet(t, cache)
+	clock.Advance(time.Hour)
+
+	go cache.ForceRefresh(time.UTC)
+	<-blocked
+	results := make(chan string, 4)
+	for range cap(results) {
+		go func() { results <- getUID(t, cache) }()
+	}
+	select {
+	case uid := <-results:
+		t.Fatalf("got %q without waiting for the refresh", uid)
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	for range cap(results) {
+		if uid := <-results; uid != "b" {
+			t.Fatalf("got %q after waiting for the refresh", uid)
+		}
+	}
+}
+
+func TestAsyncRefresh(t *testing.T) {
+	server, blocked, release := blockingServer(t)
+	clock := newFakeClock()
+	cache := &Cache{Config: Config{URL: server.URL}, AsyncRefresh: true}
+	cache.SetClock(clock.Now)
+	mustGet(t, cache) // the first call waits
+	clock.Advance(time.Hour)
+
+	if uid := getUID(t, cache); uid != "a" {
+		t.Fatalf("got %q", uid)
+	}
+	<-blocked // refreshing in the background
+	if uid := getUID(t, cache); uid != "a" {
+		t.Fatalf("got %q during the refresh", uid)
+	}
+	release()
+	for deadline := time.Now().Add(time.Second); getUID(t, cache) != "b"; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("background refresh has not been published")
+		}
+	}
+}
+
+func TestConcurrentTLS(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, testCalendar("a"))
+	})
+	first := httptest.NewTLSServer(handler)
+	defer first.Close()
+	second := httptest.NewTLSServer(handler)
+	defer second.Close()
+
+	var wg sync.WaitGroup
+	for i := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			url := first.URL
+			if i%2 == 1 {
+				url = second.URL
+			}
+			skip := i%4 < 2
+			cache := &Cache{Config: Config{URL: url, SkipTLSVerify: skip}}
+			_, _, err := cache.Get(time.UTC)
+			if skip && err != nil {
+				t.Errorf("SkipTLSVerify: %v", err)
+			}
+			if !skip && err == nil {
+				t.Error("self-signed certificate has been accepted without SkipTLSVerify")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestReadWhileRefreshing(t *testing.T) {
+	server := changingServer(t)
+	cache := &Cache{Config: Config{URL: server.URL}}
+	held := mustGet(t, cache)
+	want := held[0]
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				events, _, _ := cache.Get(time.UTC)
+				for _, event := range events {
+					_ = event.UID + event.Summary
+					_ = event.Start.Before(event.End)
+				}
+				runtime.Gosched()
+			}
+		}()
+	}
+	for range 20 {
+		if _, _, err := cache.ForceRefresh(time.UTC); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+	if len(held) != 1 || !eventEqual(held[0], want) {
+		t.Fatalf("a held slice has been modified: %+v", held)
+	}
+}
@@ -0,0 +1,101 @@
+package icalcache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/emersion/go-ical"
+)
+
+// decodeEvents reads the first VCALENDAR from r and calls fn for each of its VEVENT components. The components are decoded one by one, so the whole decoded calendar is never kept in memory. It returns io.EOF if r contains no calendar.
+func decodeEvents(r io.Reader, fn func(ical.Event) error) error {
+	br := bufio.NewReader(r)
+	var component strings.Builder // current VEVENT including its children, without the line endings
+	var depth int                 // 1 means inside VCALENDAR
+	var inEvent bool
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if line == "" && err == io.EOF {
+			break
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		name, value := delimiter(line)
+		switch {
+		case depth == 0 && strings.TrimSpace(line) == "":
+			continue
+		case depth == 0 && name != "BEGIN":
+			return fmt.Errorf("ical: malformed component: expected BEGIN property, got %q", line)
+		case depth == 0 && value != ical.CompCalendar:
+			return fmt.Errorf("ical: invalid toplevel component name: expected %q, got %q", ical.CompCalendar, value)
+		case depth == 1 && name == "BEGIN" && value == ical.CompEvent:
+			inEvent = true
+		}
+		if name == "BEGIN" {
+			depth++
+		}
+		if inEvent {
+			component.WriteString(line)
+			component.WriteString("\r\n")
+		}
+		if name == "END" {
+			depth--
+			switch {
+			case depth == 0:
+				return nil // ignore further calendars
+			case depth == 1 && inEvent:
+				event, err := decodeEvent(component.String())
+				if err != nil {
+					return err
+				}
+				if err := fn(event); err != nil {
+					return err
+				}
+				component.Reset()
+				inEvent = false
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if depth == 0 {
+		return io.EOF
+	}
+	return errors.New("ical: unexpected end of calendar")
+}
+
+// delimiter returns the upper-cased name and value of a BEGIN or END line. Continuation lines of folded properties start with a space or tab and are never delimiters.
+func delimiter(line string) (name, value string) {
+	if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+		return "", ""
+	}
+	name, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return "", ""
+	}
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if name != "BEGIN" && name != "END" {
+		return "", ""
+	}
+	return name, strings.ToUpper(strings.TrimSpace(value))
+}
+
+// decodeEvent decodes a single VEVENT component.
+func decodeEvent(component string) (ical.Event, error) {
+	cal, err := ical.NewDecoder(strings.NewReader("BEGIN:VCALENDAR\r\n" + component + "END:VCALENDAR\r\n")).Decode()
+	if err != nil {
+		return ical.Event{}, err
+	}
+	events := cal.Events()
+	if len(events) != 1 {
+		return ical.Event{}, errors.New("ical: malformed event component")
+	}
+	return events[0], nil
+}
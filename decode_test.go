@@ -0,0 +1,159 @@
+package icalcache
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-ical"
+)
+
+// TestDecodeEventsFixtures compares decodeEvents with the decoder of go-ical.
+func TestDecodeEventsFixtures(t *testing.T) {
+	paths, err := filepath.Glob("testdata/*.ics")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no fixtures: %v", err)
+	}
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cal, err := ical.NewDecoder(bytes.NewReader(raw)).Decode()
+			if err != nil {
+				t.Fatalf("go-ical: %v", err)
+			}
+			want := cal.Events()
+
+			var got []ical.Event
+			err = decodeEvents(bytes.NewReader(raw), func(event ical.Event) error {
+				got = append(got, event)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("decodeEvents: %v", err)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("got %d events, want %d", len(got), len(want))
+			}
+			for i := range want {
+				if !reflect.DeepEqual(got[i].Component, want[i].Component) {
+					t.Errorf("event %d differs:\ngot  %+v\nwant %+v", i, got[i].Component, want[i].Component)
+				}
+			}
+		})
+	}
+}
+
+// TestDecodeEventsFolded is a regression test for continuation lines which look like delimiters.
+func TestDecodeEventsFolded(t *testing.T) {
+	raw := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:a\r\nDTSTART:20240101T100000Z\r\nDESCRIPTION:first line\r\n END:VCALENDAR\r\n\tBEGIN:VEVENT\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	var descriptions []string
+	err := decodeEvents(strings.NewReader(raw), func(event ical.Event) error {
+		description, _ := event.Props.Text(ical.PropDescription)
+		descriptions = append(descriptions, description)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "first lineEND:VCALENDARBEGIN:VEVENT"; len(descriptions) != 1 || descriptions[0] != want {
+		t.Fatalf("got %q, want %q", descriptions, want)
+	}
+}
+
+func TestDecodeEventsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want error
+	}{
+		{"empty", "", io.EOF},
+		{"blank lines", "\r\n\r\n", io.EOF},
+		{"truncated", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:a\r\n", nil},
+		{"wrong toplevel component", "BEGIN:VEVENT\r\nEND:VEVENT\r\n", nil},
+		{"garbage", "<html></html>\r\n", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := decodeEvents(strings.NewReader(test.raw), func(ical.Event) error { return nil })
+			switch {
+			case test.want != nil && err != test.want:
+				t.Fatalf("got %v, want %v", err, test.want)
+			case test.want == nil && (err == nil || err == io.EOF):
+				t.Fatalf("got %v, want an error", err)
+			}
+		})
+	}
+}
+
+// largeCalendar returns a calendar with n events.
+func largeCalendar(n int) []byte {
+	var b bytes.Buffer
+	b.WriteString("BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//large//EN\r\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "BEGIN:VEVENT\r\nUID:event-%d@example.com\r\nDTSTAMP:20240101T000000Z\r\nDTSTART:20240101T100000Z\r\nDTEND:20240101T110000Z\r\nSUMMARY:Talk number %d\r\nDESCRIPTION:%s\r\nLOCATION:Room %d\r\nEND:VEVENT\r\n", i, i, strings.Repeat("Lorem ipsum dolor sit amet. ", 10), i%20)
+	}
+	b.WriteString("END:VCALENDAR\r\n")
+	return b.Bytes()
+}
+
+// peakHeap tracks the largest heap size which has been sampled.
+type peakHeap struct {
+	stats runtime.MemStats
+	peak  uint64
+}
+
+func (p *peakHeap) sample() {
+	runtime.ReadMemStats(&p.stats)
+	p.peak = max(p.peak, p.stats.HeapAlloc)
+}
+
+// BenchmarkDecodeEvents and BenchmarkDecodeGoICal compare the peak heap of streaming with decoding the whole calendar at once, as before. The raw calendar is part of both.
+func BenchmarkDecodeEvents(b *testing.B) {
+	raw := largeCalendar(20000)
+	var heap peakHeap
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+		var n int
+		err := decodeEvents(bytes.NewReader(raw), func(event ical.Event) error {
+			if n++; n%1000 == 0 {
+				heap.sample()
+			}
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(heap.peak), "peak-heap-bytes")
+}
+
+func BenchmarkDecodeGoICal(b *testing.B) {
+	raw := largeCalendar(20000)
+	var heap peakHeap
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+		cal, err := ical.NewDecoder(bytes.NewReader(raw)).Decode()
+		if err != nil {
+			b.Fatal(err)
+		}
+		for n := range cal.Events() {
+			if n%1000 == 0 {
+				heap.sample()
+			}
+		}
+	}
+	b.ReportMetric(float64(heap.peak), "peak-heap-bytes")
+}
@@ -0,0 +1,71 @@
+package icalcache
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+)
+
+// encodeHostOverride returns a comparable representation of Config.HostOverride.
+func encodeHostOverride(overrides map[string]string) string {
+	var lines []string
+	for host, addr := range overrides {
+		lines = append(lines, strings.ToLower(host)+"="+addr)
+	}
+	slices.Sort(lines)
+	return strings.Join(lines, "\n")
+}
+
+func decodeHostOverride(encoded string) map[string]string {
+	overrides := make(map[string]string)
+	for _, line := range strings.Split(encoded, "\n") {
+		if host, addr, ok := strings.Cut(line, "="); ok {
+			overrides[host] = addr
+		}
+	}
+	return overrides
+}
+
+// overrideAddr replaces the host of addr if it is in overrides. The override value can omit the port.
+func overrideAddr(overrides map[string]string, addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	target, ok := overrides[strings.ToLower(host)]
+	if !ok {
+		return addr
+	}
+	if _, _, err := net.SplitHostPort(target); err == nil {
+		return target
+	}
+	return net.JoinHostPort(target, port)
+}
+
+// dialContext returns the DialContext function for the transport, or nil if the default is fine.
+func (tc transportConfig) dialContext() func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if tc.UnixSocket != "" {
+		var dialer net.Dialer
+		return func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", tc.UnixSocket)
+		}
+	}
+	if !tc.BlockPrivateAddresses && tc.Resolver == nil && tc.HostOverride == "" {
+		return nil
+	}
+	dialer := &net.Dialer{
+		Resolver: tc.Resolver,
+	}
+	if tc.BlockPrivateAddresses {
+		dialer.Control = blockPrivateAddresses
+	}
+	if tc.HostOverride == "" {
+		return dialer.DialContext
+	}
+	overrides := decodeHostOverride(tc.HostOverride)
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		// TLS server name and Host header are taken from the request URL, so they keep the original host
+		return dialer.DialContext(ctx, network, overrideAddr(overrides, addr))
+	}
+}
@@ -0,0 +1,94 @@
+package icalcache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// hostServer serves a calendar and records the Host header of the last request.
+func hostServer(t *testing.T) (*httptest.Server, *atomic.Value) {
+	var host atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host.Store(r.Host)
+		io.WriteString(w, testCalendar("a"))
+	}))
+	t.Cleanup(server.Close)
+	return server, &host
+}
+
+func TestHostOverride(t *testing.T) {
+	server, host := hostServer(t)
+	ip, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	tests := []struct {
+		url      string
+		override string
+	}{
+		{"http://calendar.invalid:" + port + "/", ip},
+		{"http://calendar.invalid/", ip + ":" + port},
+		{"http://CALENDAR.invalid/", ip + ":" + port},
+	}
+	for _, test := range tests {
+		cache := &Cache{Config: Config{URL: test.url, HostOverride: map[string]string{"calendar.invalid": test.override}}, Retries: -1}
+		if events := mustGet(t, cache); len(events) != 1 {
+			t.Fatalf("%s: got %v", test.url, events)
+		}
+		if got := host.Load().(string); got != test.url[len("http://"):len(test.url)-1] {
+			t.Fatalf("%s: got Host header %s", test.url, got)
+		}
+	}
+}
+
+func TestResolver(t *testing.T) {
+	var lookups atomic.Int64
+	errDNS := errors.New("no dns in tests")
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			lookups.Add(1)
+			return nil, errDNS
+		},
+	}
+	cache := &Cache{Config: Config{URL: "http://calendar.invalid/"}, Resolver: resolver, Retries: -1}
+	if _, _, err := cache.Get(time.UTC); err == nil {
+		t.Fatal("got no error")
+	}
+	if lookups.Load() == 0 {
+		t.Fatal("the resolver has not been used")
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "calendar.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip(err)
+	}
+	var host atomic.Value
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host.Store(r.Host + r.URL.Path)
+		io.WriteString(w, testCalendar("a"))
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	cache := &Cache{Config: Config{URL: "http://calendar.invalid/team.ics", UnixSocket: socket}}
+	if events := mustGet(t, cache); len(events) != 1 {
+		t.Fatalf("got %v", events)
+	}
+	if got := host.Load().(string); got != "calendar.invalid/team.ics" {
+		t.Fatalf("got host and path %s", got)
+	}
+	cache = &Cache{Config: Config{URL: "http://calendar.invalid/team.ics", UnixSocket: socket}, BlockPrivateAddresses: true}
+	if _, _, err := cache.Get(time.UTC); err == nil {
+		t.Fatal("BlockPrivateAddresses has been combined with UnixSocket")
+	}
+}
@@ -0,0 +1,143 @@
+package icalcache
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Diff describes how events have changed, matched by UID. If several events share a UID, like the occurrences of a recurring event which have been modified, they are matched in order.
+type Diff struct {
+	Added   []Event
+	Removed []Event
+	Changed []EventChange
+}
+
+// EventChange is an event which has been modified.
+type EventChange struct {
+	Old    Event
+	New    Event
+	Fields []string // names of the Event fields which differ
+}
+
+// Empty reports whether nothing has changed.
+func (diff Diff) Empty() bool {
+	return len(diff.Added) == 0 && len(diff.Removed) == 0 && len(diff.Changed) == 0
+}
+
+// DiffEvents compares two event lists, for example the arguments of OnChange. Events are compared by their parsed fields, so the order of properties in the ical data doesn't matter.
+func DiffEvents(old, new []Event) Diff {
+	oldByKey := make(map[string]Event, len(old))
+	for key, event := range eventKeys(old) {
+		oldByKey[key] = event
+	}
+	var diff Diff
+	for key, event := range eventKeys(new) {
+		oldEvent, ok := oldByKey[key]
+		if !ok {
+			diff.Added = append(diff.Added, event)
+			continue
+		}
+		delete(oldByKey, key)
+		if fields := changedFields(oldEvent, event); fields != nil {
+			diff.Changed = append(diff.Changed, EventChange{oldEvent, event, fields})
+		}
+	}
+	for key, event := range eventKeys(old) { // keep the order of old
+		if _, ok := oldByKey[key]; ok {
+			diff.Removed = append(diff.Removed, event)
+		}
+	}
+	return diff
+}
+
+// eventKeys yields the events with their UID and the number of previous events with the same UID.
+func eventKeys(events []Event) func(yield func(string, Event) bool) {
+	return func(yield func(string, Event) bool) {
+		seen := make(map[string]int, len(events))
+		for _, event := range events {
+			n := seen[event.UID]
+			seen[event.UID] = n + 1
+			if !yield(fmt.Sprintf("%s\x00%d", event.UID, n), event) {
+				return
+			}
+		}
+	}
+}
+
+// LastDiff returns the changes of the last refresh which has replaced the cached events, see Generation. It waits for a running refresh.
+func (cache *Cache) LastDiff() Diff {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	return DiffEvents(cache.previousEvents, cache.generationEvents)
+}
+
+// changedFields returns the names of the fields which differ, or nil. Times are compared with Equal, so their locations don't matter.
+func changedFields(a, b Event) []string {
+	var fields []string
+	if a.AllDay != b.AllDay {
+		fields = append(fields, "AllDay")
+	}
+	if !a.Start.Equal(b.Start) {
+		fields = append(fields, "Start")
+	}
+	if !a.End.Equal(b.End) {
+		fields = append(fields, "End")
+	}
+	if a.RecurrenceSet != b.RecurrenceSet {
+		fields = append(fields, "RecurrenceSet")
+	}
+	if a.UID != b.UID {
+		fields = append(fields, "UID")
+	}
+	if a.URL != b.URL {
+		fields = append(fields, "URL")
+	}
+	if a.Summary != b.Summary {
+		fields = append(fields, "Summary")
+	}
+	if a.Description != b.Description {
+		fields = append(fields, "Description")
+	}
+	if a.Location != b.Location {
+		fields = append(fields, "Location")
+	}
+	if a.Organizer != b.Organizer {
+		fields = append(fields, "Organizer")
+	}
+	if !slices.Equal(a.Attendees, b.Attendees) {
+		fields = append(fields, "Attendees")
+	}
+	if a.Status != b.Status {
+		fields = append(fields, "Status")
+	}
+	if !slices.Equal(a.Categories, b.Categories) {
+		fields = append(fields, "Categories")
+	}
+	if (a.Geo == nil) != (b.Geo == nil) || a.Geo != nil && *a.Geo != *b.Geo {
+		fields = append(fields, "Geo")
+	}
+	if !slices.EqualFunc(a.Alarms, b.Alarms, alarmEqual) {
+		fields = append(fields, "Alarms")
+	}
+	if a.Transparent != b.Transparent {
+		fields = append(fields, "Transparent")
+	}
+	if !a.Created.Equal(b.Created) {
+		fields = append(fields, "Created")
+	}
+	if !a.LastModified.Equal(b.LastModified) {
+		fields = append(fields, "LastModified")
+	}
+	if a.Sequence != b.Sequence {
+		fields = append(fields, "Sequence")
+	}
+	if !slices.EqualFunc(a.ExceptionDates, b.ExceptionDates, time.Time.Equal) {
+		fields = append(fields, "ExceptionDates")
+	}
+	return fields
+}
+
+func alarmEqual(a, b Alarm) bool {
+	return a.Action == b.Action && a.Before == b.Before && a.RelatedEnd == b.RelatedEnd && a.Time.Equal(b.Time) && a.Description == b.Description
+}
@@ -0,0 +1,81 @@
+package icalcache
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDiffEvents(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	event := func(uid, summary string, start time.Time) Event {
+		return Event{UID: uid, Summary: summary, Start: start, End: start.Add(time.Hour)}
+	}
+	a := event("a", "A", start)
+	b := event("b", "B", start)
+	master := event("r", "Weekly", start)
+	override := event("r", "Weekly", start.Add(7*24*time.Hour)) // an occurrence with RECURRENCE-ID shares the UID
+	moved := event("r", "Weekly", start.Add(8*24*time.Hour))
+
+	tests := []struct {
+		name      string
+		old, new  []Event
+		added     []string // summaries
+		removed   []string
+		changed   []string
+		fields    []string // of the first change
+		wantEmpty bool
+	}{
+		{name: "equal", old: []Event{a, b}, new: []Event{a, b}, wantEmpty: true},
+		{name: "reordered", old: []Event{a, b}, new: []Event{b, a}, wantEmpty: true},
+		{name: "other location", old: []Event{a}, new: []Event{event("a", "A", start.In(time.FixedZone("+1", 3600)))}, wantEmpty: true},
+		{name: "added", old: []Event{a}, new: []Event{a, b}, added: []string{"B"}},
+		{name: "removed", old: []Event{a, b}, new: []Event{b}, removed: []string{"A"}},
+		{name: "changed by uid", old: []Event{a, b}, new: []Event{b, event("a", "A2", start)}, changed: []string{"A2"}, fields: []string{"Summary"}},
+		{name: "new uid", old: []Event{a}, new: []Event{event("a2", "A", start)}, added: []string{"A"}, removed: []string{"A"}},
+		{name: "override added", old: []Event{master}, new: []Event{master, override}, added: []string{"Weekly"}},
+		{name: "override moved", old: []Event{master, override}, new: []Event{master, moved}, changed: []string{"Weekly"}, fields: []string{"Start", "End"}},
+		{name: "override removed", old: []Event{master, override}, new: []Event{master}, removed: []string{"Weekly"}},
+	}
+	summaries := func(events []Event) []string {
+		var s []string
+		for _, event := range events {
+			s = append(s, event.Summary)
+		}
+		return s
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diff := DiffEvents(test.old, test.new)
+			if diff.Empty() != test.wantEmpty {
+				t.Fatalf("got Empty %v for %+v", diff.Empty(), diff)
+			}
+			var changed []Event
+			for _, change := range diff.Changed {
+				changed = append(changed, change.New)
+			}
+			if !slices.Equal(summaries(diff.Added), test.added) || !slices.Equal(summaries(diff.Removed), test.removed) || !slices.Equal(summaries(changed), test.changed) {
+				t.Fatalf("got added %v, removed %v, changed %v", summaries(diff.Added), summaries(diff.Removed), summaries(changed))
+			}
+			if len(diff.Changed) > 0 && !slices.Equal(diff.Changed[0].Fields, test.fields) {
+				t.Fatalf("got fields %v, want %v", diff.Changed[0].Fields, test.fields)
+			}
+		})
+	}
+}
+
+func TestLastDiff(t *testing.T) {
+	body := testCalendar("a", "b")
+	server, _ := calendarServer(t, &body)
+	cache := &Cache{Config: Config{URL: server.URL}}
+	mustGet(t, cache)
+	if diff := cache.LastDiff(); len(diff.Added) != 2 {
+		t.Fatalf("got %+v after the first refresh", diff)
+	}
+	body = testCalendar("a", "b", "c")
+	cache.ForceRefresh(time.UTC)
+	cache.ForceRefresh(time.UTC) // unchanged, keeps the last diff
+	if diff := cache.LastDiff(); len(diff.Added) != 1 || diff.Added[0].UID != "c" || len(diff.Removed) != 0 || len(diff.Changed) != 0 {
+		t.Fatalf("got %+v", diff)
+	}
+}
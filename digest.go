@@ -0,0 +1,238 @@
+package icalcache
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// digestCredentials is the context key of the *url.Userinfo which newRequest has found for the requested url, so mirrors can have their own credentials.
+type digestCredentials struct{}
+
+// digestAuth holds the server challenge of HTTP Digest authentication (RFC 7616), so its nonce can be reused for subsequent requests.
+type digestAuth struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string // upper case, like "MD5" or "SHA-256-sess"
+	qop       string // "auth" or empty
+	nc        int    // nonce count
+}
+
+// parseDigestChallenge parses the values of WWW-Authenticate headers and returns the first supported Digest challenge.
+func parseDigestChallenge(headers []string) (*digestAuth, bool) {
+	for _, header := range headers {
+		scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+		if !strings.EqualFold(scheme, "Digest") {
+			continue
+		}
+		params := parseAuthParams(rest)
+		auth := &digestAuth{
+			realm:     params["realm"],
+			nonce:     params["nonce"],
+			opaque:    params["opaque"],
+			algorithm: strings.ToUpper(params["algorithm"]),
+		}
+		if auth.algorithm == "" {
+			auth.algorithm = "MD5"
+		}
+		if auth.hash() == nil || auth.nonce == "" {
+			continue
+		}
+		if qop, ok := params["qop"]; ok {
+			var supported = false
+			for _, option := range strings.Split(qop, ",") {
+				if strings.TrimSpace(option) == "auth" {
+					supported = true
+				}
+			}
+			if !supported {
+				continue // auth-int is not supported
+			}
+			auth.qop = "auth"
+		}
+		return auth, true
+	}
+	return nil, false
+}
+
+// parseAuthParams parses a comma-separated list of key=value or key="quoted value" pairs.
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return params
+		}
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			return params
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		rest = strings.TrimLeft(rest, " \t")
+		var value strings.Builder
+		if strings.HasPrefix(rest, `"`) {
+			rest = rest[1:]
+			for len(rest) > 0 && rest[0] != '"' {
+				if rest[0] == '\\' && len(rest) > 1 {
+					rest = rest[1:]
+				}
+				value.WriteByte(rest[0])
+				rest = rest[1:]
+			}
+			rest = strings.TrimPrefix(rest, `"`)
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end < 0 {
+				end = len(rest)
+			}
+			value.WriteString(strings.TrimSpace(rest[:end]))
+			rest = rest[end:]
+		}
+		params[key] = value.String()
+		s = rest
+	}
+}
+
+func (auth *digestAuth) hash() func() hash.Hash {
+	switch strings.TrimSuffix(auth.algorithm, "-SESS") {
+	case "MD5":
+		return md5.New
+	case "SHA-256":
+		return sha256.New
+	default:
+		return nil
+	}
+}
+
+func (auth *digestAuth) h(s string) string {
+	h := auth.hash()()
+	h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// authorize sets the Authorization header of req and increments the nonce count.
+func (auth *digestAuth) authorize(req *http.Request, username, password string) error {
+	var cnonceBytes = make([]byte, 16)
+	if _, err := rand.Read(cnonceBytes); err != nil {
+		return fmt.Errorf("generating digest cnonce: %w", err)
+	}
+	cnonce := hex.EncodeToString(cnonceBytes)
+	auth.nc++
+	nc := fmt.Sprintf("%08x", auth.nc)
+	uri := req.URL.RequestURI()
+
+	ha1 := auth.h(username + ":" + auth.realm + ":" + password)
+	if strings.HasSuffix(auth.algorithm, "-SESS") {
+		ha1 = auth.h(ha1 + ":" + auth.nonce + ":" + cnonce)
+	}
+	ha2 := auth.h(req.Method + ":" + uri)
+
+	var response string
+	if auth.qop == "" {
+		response = auth.h(ha1 + ":" + auth.nonce + ":" + ha2)
+	} else {
+		response = auth.h(ha1 + ":" + auth.nonce + ":" + nc + ":" + cnonce + ":" + auth.qop + ":" + ha2)
+	}
+
+	header := fmt.Sprintf(`Digest username=%q, realm=%q, nonce=%q, uri=%q, algorithm=%s, response=%q`, username, auth.realm, auth.nonce, uri, auth.algorithm, response)
+	if auth.qop != "" {
+		header += fmt.Sprintf(`, qop=%s, nc=%s, cnonce=%q`, auth.qop, nc, cnonce)
+	}
+	if auth.opaque != "" {
+		header += fmt.Sprintf(`, opaque=%q`, auth.opaque)
+	}
+	req.Header.Set("Authorization", header)
+	return nil
+}
+
+// do sends an upstream request. If Digest authentication is configured, it reuses the last challenge or answers a new one, unless Config.Headers has set an Authorization header. The caller must hold the lock.
+func (cache *Cache) do(req *http.Request) (*http.Response, error) {
+	s, err := cache.sender()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req)
+	if s.useDigest {
+		cache.digest = s.digest
+	}
+	return resp, err
+}
+
+// sender sends requests like Cache.do, but without accessing the cache, so it can be used without holding the lock.
+type sender struct {
+	client    *http.Client
+	limiter   Limiter
+	useDigest bool
+	digest    *digestAuth // copy of the last challenge, or nil
+}
+
+// sender returns a sender with the client, limiter and digest state of the cache. The caller must hold the lock.
+func (cache *Cache) sender() (*sender, error) {
+	client, err := cache.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	s := &sender{client: client, limiter: cache.Limiter}
+	if cache.AuthScheme == AuthDigest {
+		s.useDigest = true
+		if cache.digest != nil {
+			digest := *cache.digest // the nonce count is written back by Cache.do only
+			s.digest = &digest
+		}
+	}
+	return s, nil
+}
+
+func (s *sender) do(req *http.Request) (*http.Response, error) {
+	if s.limiter != nil {
+		if err := s.limiter.Wait(req.Context()); err != nil {
+			return nil, fmt.Errorf("waiting for rate limiter: %w", err)
+		}
+	}
+	credentials, _ := req.Context().Value(digestCredentials{}).(*url.Userinfo)
+	if !s.useDigest || credentials == nil || req.Header.Get("Authorization") != "" {
+		resp, err := s.client.Do(req)
+		return resp, wrapTransportError(err)
+	}
+	username := credentials.Username()
+	password, _ := credentials.Password()
+
+	if s.digest != nil {
+		if err := s.digest.authorize(req, username, password); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, wrapTransportError(err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+
+	// answer the (new or renewed) challenge
+	challenge, ok := parseDigestChallenge(resp.Header.Values("WWW-Authenticate"))
+	if !ok {
+		return resp, nil
+	}
+	closeBody(resp.Body)
+	s.digest = challenge
+	req = req.Clone(req.Context())
+	if req.GetBody != nil { // the body has been consumed by the first attempt
+		if req.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.digest.authorize(req, username, password); err != nil {
+		return nil, err
+	}
+	resp, err = s.client.Do(req)
+	return resp, wrapTransportError(err)
+}
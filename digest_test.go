@@ -0,0 +1,107 @@
+package icalcache
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// digestServer serves a calendar to requests which answer its Digest challenge with username and password.
+func digestServer(t *testing.T, algorithm, username, password string) (*httptest.Server, *atomic.Int64) {
+	var challenges atomic.Int64
+	server := httptest.NewServer(digestHandler(&challenges, algorithm, username, password))
+	t.Cleanup(server.Close)
+	return server, &challenges
+}
+
+func digestHandler(challenges *atomic.Int64, algorithm, username, password string) http.Handler {
+	auth := &digestAuth{realm: "test", nonce: "dcd98b7102dd2f0e8b11d0f600bfb0c093", algorithm: algorithm}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme, rest, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		params := parseAuthParams(rest)
+		ha1 := auth.h(username + ":" + auth.realm + ":" + password)
+		ha2 := auth.h(r.Method + ":" + r.URL.RequestURI())
+		want := auth.h(ha1 + ":" + auth.nonce + ":" + params["nc"] + ":" + params["cnonce"] + ":auth:" + ha2)
+		if scheme != "Digest" || params["username"] != username || params["qop"] != "auth" || params["opaque"] != "opaque" || params["response"] != want {
+			challenges.Add(1)
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="test", qop="auth,auth-int", algorithm=%s, nonce="%s", opaque="opaque"`, algorithm, auth.nonce))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, testCalendar("a"))
+	})
+}
+
+func TestDigestRoundTrip(t *testing.T) {
+	for _, algorithm := range []string{"MD5", "SHA-256"} {
+		t.Run(algorithm, func(t *testing.T) {
+			server, challenges := digestServer(t, algorithm, "alice", "secret")
+			cache := &Cache{Config: Config{URL: server.URL, Username: "alice", Password: "secret", AuthScheme: AuthDigest}}
+			for range 3 {
+				if _, _, err := cache.ForceRefresh(time.UTC); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := challenges.Load(); got != 1 {
+				t.Fatalf("got %d challenges, want 1 because the nonce is reused", got)
+			}
+			if cache.digest.nc != 3 {
+				t.Fatalf("got nonce count %d", cache.digest.nc)
+			}
+		})
+	}
+}
+
+func TestDigestWrongPassword(t *testing.T) {
+	server, _ := digestServer(t, "MD5", "alice", "secret")
+	cache := &Cache{Config: Config{URL: server.URL, Username: "alice", Password: "wrong", AuthScheme: AuthDigest}}
+	if _, _, err := cache.Get(time.UTC); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestDigestMirrorCredentials(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer primary.Close()
+	mirror, _ := digestServer(t, "MD5", "bob", "mirror-secret")
+
+	cache := &Cache{Config: Config{
+		URL:        strings.Replace(primary.URL, "http://", "http://alice:secret@", 1),
+		URLs:       []string{strings.Replace(mirror.URL, "http://", "http://bob:mirror-secret@", 1)},
+		AuthScheme: AuthDigest,
+	}}
+	if events := mustGet(t, cache); len(events) != 1 {
+		t.Fatalf("got %v", uids(events))
+	}
+}
+
+func TestDigestHeadersWin(t *testing.T) {
+	var challenges atomic.Int64
+	digest := digestHandler(&challenges, "MD5", "alice", "secret")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer token" {
+			io.WriteString(w, testCalendar("bearer"))
+			return
+		}
+		digest.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	cache := &Cache{Config: Config{URL: server.URL, Username: "alice", Password: "secret", AuthScheme: AuthDigest}}
+	mustGet(t, cache) // answers a challenge
+
+	cache.Headers = map[string]string{"Authorization": "Bearer token"}
+	events, _, err := cache.ForceRefresh(time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := uids(events); len(got) != 1 || got[0] != "bearer" {
+		t.Fatalf("got %v, the digest response has replaced the Authorization header", got)
+	}
+}
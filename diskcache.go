@@ -0,0 +1,131 @@
+package icalcache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// diskCacheHeader is the first line of a file in CacheDir. The body follows it unchanged.
+type diskCacheHeader struct {
+	URLsHash         string `json:"urls-hash"` // not the URLs, because they can contain credentials
+	HashSum          string `json:"hash-sum"`  // of the body, detects truncated files
+	ETag             string `json:"etag"`
+	HTTPLastModified string `json:"http-last-modified"`
+	LastModified     int64  `json:"last-modified"`
+	CTag             string `json:"ctag"`
+}
+
+// diskCachePath returns the path of the cache file, named by a hash of the URLs.
+func (cache *Cache) diskCachePath() string {
+	return filepath.Join(cache.CacheDir, cache.urlsHash()+".ics")
+}
+
+// loadDiskCache reads the cache file and sets the events and validators from it. It reports whether the file could be used. The caller must hold the lock.
+func (cache *Cache) loadDiskCache(defaultLocation *time.Location) bool {
+	err := cache.readDiskCache(defaultLocation)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) && cache.Logger != nil {
+		cache.Logger.Warn("ignoring cache file", "error", err)
+	}
+	return err == nil
+}
+
+func (cache *Cache) readDiskCache(defaultLocation *time.Location) error {
+	data, err := os.ReadFile(cache.diskCachePath())
+	if err != nil {
+		return err
+	}
+	line, raw, ok := bytes.Cut(data, []byte("\n"))
+	if !ok {
+		return errors.New("missing header")
+	}
+	var header diskCacheHeader
+	if err := json.Unmarshal(line, &header); err != nil {
+		return fmt.Errorf("decoding header: %w", err)
+	}
+	if header.URLsHash != cache.urlsHash() {
+		return errors.New("file belongs to other urls")
+	}
+	hash := fnv.New64()
+	hash.Write(raw)
+	hashSum := base64.StdEncoding.EncodeToString(hash.Sum(nil))
+	if header.HashSum != hashSum {
+		return errors.New("hash mismatch")
+	}
+	events, warnings, truncated, err := cache.parseEvents(bytes.NewReader(raw), defaultLocation)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	cache.events = events
+	cache.warnings = warnings
+	cache.truncated = truncated
+	cache.raw = nil
+	if cache.KeepRaw {
+		cache.raw = raw
+	}
+	cache.lastHashSum = hashSum
+	cache.lastContentHash = cache.contentHash(events, hashSum)
+	cache.lastLocation = defaultLocation.String()
+	cache.lastModified = header.LastModified
+	cache.lastURL = strings.Join(cache.urls(), " ") // keep the validators in refresh
+	cache.lastETag = header.ETag
+	cache.lastHTTPLastModified = header.HTTPLastModified
+	cache.lastCTag = header.CTag
+	return nil
+}
+
+// saveDiskCache writes raw and the current validators to the cache file. Errors are only logged, because the cache file is an optimization. The caller must hold the lock.
+func (cache *Cache) saveDiskCache(raw []byte, hashSum string) {
+	if cache.CacheDir == "" {
+		return
+	}
+	if err := cache.writeDiskCache(raw, hashSum); err != nil && cache.Logger != nil {
+		cache.Logger.Warn("writing cache file", "error", err)
+	}
+}
+
+// writeDiskCache replaces the cache file atomically, so readers never see a partial file.
+func (cache *Cache) writeDiskCache(raw []byte, hashSum string) error {
+	header, err := json.Marshal(diskCacheHeader{
+		URLsHash:         cache.urlsHash(),
+		HashSum:          hashSum,
+		ETag:             cache.lastETag,
+		HTTPLastModified: cache.lastHTTPLastModified,
+		LastModified:     cache.lastModified,
+		CTag:             cache.lastCTag,
+	})
+	if err != nil {
+		return err
+	}
+
+	path := cache.diskCachePath()
+	tmp, err := os.CreateTemp(cache.CacheDir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly after the rename
+
+	w := bufio.NewWriter(tmp)
+	w.Write(header)
+	w.WriteByte('\n')
+	w.Write(raw)
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,88 @@
+package icalcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDiskCache(t *testing.T) {
+	var gets, notModified atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		gets.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		io.WriteString(w, testCalendar("a", "b"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	config := Config{URL: strings.Replace(server.URL, "http://", "http://user:secret@", 1)}
+	first := &Cache{Config: config, CacheDir: dir}
+	mustGet(t, first)
+
+	// a new cache, like after a restart, serves the stored events and sends a conditional request
+	restarted := &Cache{Config: config, CacheDir: dir}
+	if events := mustGet(t, restarted); len(events) != 2 {
+		t.Fatalf("got %v", uids(events))
+	}
+	if gets.Load() != 1 || notModified.Load() != 1 {
+		t.Fatalf("got %d downloads and %d not modified responses", gets.Load(), notModified.Load())
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.ics"))
+	if len(files) != 1 {
+		t.Fatalf("got files %v", files)
+	}
+	sum := sha256.Sum256([]byte(config.URL))
+	if want := hex.EncodeToString(sum[:]) + ".ics"; filepath.Base(files[0]) != want {
+		t.Fatalf("got file %s, want the SHA-256 hash of the url %s", filepath.Base(files[0]), want)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret") || strings.Contains(string(data), server.Listener.Addr().String()) {
+		t.Fatal("the cache file contains the url")
+	}
+}
+
+func TestDiskCacheCorrupt(t *testing.T) {
+	var gets atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gets.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		io.WriteString(w, testCalendar("a"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	cache := &Cache{Config: Config{URL: server.URL}, CacheDir: dir}
+	if err := os.WriteFile(cache.diskCachePath(), []byte("{}\ngarbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if events := mustGet(t, cache); len(events) != 1 {
+		t.Fatalf("got %v", uids(events))
+	}
+
+	// the file has been overwritten and is used by the next cache
+	restarted := &Cache{Config: Config{URL: server.URL}, CacheDir: dir}
+	restarted.lock.Lock()
+	loaded := restarted.loadDiskCache(time.UTC)
+	restarted.lock.Unlock()
+	if !loaded || len(restarted.events) != 1 {
+		t.Fatal("the corrupt file has not been overwritten")
+	}
+}
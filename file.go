@@ -0,0 +1,39 @@
+package icalcache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"time"
+)
+
+// filePath returns the local path if rawURL is a file:// URL.
+func filePath(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "file" {
+		return "", false
+	}
+	return u.Path, true
+}
+
+// FileFetcher returns a Fetcher which opens a local calendar file. Its modification time is used like the HTTP Last-Modified header.
+func FileFetcher(path string) Fetcher {
+	return FetcherFunc(func(ctx context.Context) (io.ReadCloser, time.Time, bool, error) {
+		return fetchFile(path)
+	})
+}
+
+func fetchFile(path string) (io.ReadCloser, time.Time, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, time.Time{}, false, fmt.Errorf("opening calendar file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, time.Time{}, false, fmt.Errorf("getting calendar file info: %w", err)
+	}
+	return f, info.ModTime(), false, nil
+}
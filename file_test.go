@@ -0,0 +1,52 @@
+package icalcache
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileURL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "calendar.ics")
+	if err := os.WriteFile(path, []byte(testCalendar("a")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	os.Chtimes(path, modified, modified)
+	cache := &Cache{Config: Config{URL: "file://" + path}}
+
+	events, lastModified, err := cache.Get(time.UTC)
+	if err != nil || len(events) != 1 || lastModified != modified.Unix() {
+		t.Fatalf("got %v, %d, %v", events, lastModified, err)
+	}
+
+	// same modification time, the file is not parsed again
+	os.WriteFile(path, []byte(testCalendar("a", "b")), 0o600)
+	os.Chtimes(path, modified, modified)
+	if events, _, _ := cache.ForceRefresh(time.UTC); len(events) != 1 {
+		t.Fatalf("got %v although the modification time is unchanged", uids(events))
+	}
+
+	os.Chtimes(path, modified.Add(time.Hour), modified.Add(time.Hour))
+	if events, _, _ := cache.ForceRefresh(time.UTC); len(events) != 2 {
+		t.Fatalf("got %v after the file has changed", uids(events))
+	}
+
+	os.Remove(path)
+	if _, _, err := cache.ForceRefresh(time.UTC); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("got %v for a missing file", err)
+	}
+}
+
+func TestFileFetcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "calendar.ics")
+	if err := os.WriteFile(path, []byte(testCalendar("a", "b")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if events := mustGet(t, &Cache{Fetcher: FileFetcher(path)}); len(events) != 2 {
+		t.Fatalf("got %v", uids(events))
+	}
+}
@@ -0,0 +1,73 @@
+package icalcache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMaxFreshness is used if Cache.MaxFreshness is zero.
+const DefaultMaxFreshness = time.Hour
+
+// freshness returns the freshness lifetime which upstream advertises with Cache-Control max-age or Expires, or zero. Expires is relative to the Date header or, if it is missing, to now. The no-cache and no-store directives are ignored, because the refresh interval applies anyway.
+func freshness(header http.Header, now time.Time) time.Duration {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if strings.EqualFold(name, "max-age") {
+			if seconds, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil && seconds > 0 {
+				return time.Duration(seconds) * time.Second
+			}
+			return 0
+		}
+	}
+	if expires, err := http.ParseTime(header.Get("Expires")); err == nil {
+		date, err := http.ParseTime(header.Get("Date"))
+		if err != nil {
+			date = now
+		}
+		if lifetime := expires.Sub(date); lifetime > 0 {
+			return lifetime
+		}
+	}
+	return 0
+}
+
+func (cache *Cache) maxFreshness() time.Duration {
+	if cache.MaxFreshness > 0 {
+		return cache.MaxFreshness
+	}
+	return DefaultMaxFreshness
+}
+
+// nextCheck returns when upstream should be checked next: after Interval or, if larger, after the freshness lifetime advertised by upstream, capped at MaxFreshness, plus jitter. After a failed refresh, the error interval applies instead, and BreakerCooldown after BreakerThreshold failed refreshes. A Retry-After time which upstream sent with 429 or 503 delays it further. The caller must hold the lock.
+func (cache *Cache) nextCheck() time.Time {
+	wait := cache.interval()
+	if fresh := min(cache.freshness, cache.maxFreshness()); fresh > wait && cache.Interval >= 0 {
+		wait = fresh
+	}
+	switch {
+	case cache.circuitOpen():
+		wait = cache.breakerCooldown()
+	case cache.failures > 0:
+		wait = cache.errorInterval()
+	}
+	wait += time.Duration(float64(wait) * cache.jitter)
+	next := cache.lastChecked.Add(wait)
+	if cache.retryAfter.After(next) {
+		next = cache.retryAfter
+	}
+	return next
+}
+
+// backoff reports whether the next check waits for the error interval, the circuit breaker or Retry-After, which GetOptions.MaxAge does not override. The caller must hold the lock.
+func (cache *Cache) backoff() bool {
+	return cache.failures > 0 || cache.retryAfter.After(cache.now())
+}
+
+// NextCheck returns the time after which Get will check upstream again.
+func (cache *Cache) NextCheck() time.Time {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	return cache.nextCheck()
+}
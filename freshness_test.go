@@ -0,0 +1,192 @@
+package icalcache
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFreshness(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header http.Header
+		want   time.Duration
+	}{
+		{http.Header{}, 0},
+		{http.Header{"Cache-Control": {"public, max-age=600"}}, 10 * time.Minute},
+		{http.Header{"Cache-Control": {`max-age="60"`}}, time.Minute},
+		{http.Header{"Cache-Control": {"max-age=invalid"}, "Expires": {http.TimeFormat}}, 0},
+		{http.Header{"Expires": {now.Add(time.Hour).Format(http.TimeFormat)}}, time.Hour}, // relative to now
+		{http.Header{"Expires": {now.Add(time.Hour).Format(http.TimeFormat)}, "Date": {now.Add(-time.Hour).Format(http.TimeFormat)}}, 2 * time.Hour},
+		{http.Header{"Expires": {now.Add(-time.Hour).Format(http.TimeFormat)}}, 0},
+	}
+	for _, test := range tests {
+		if got := freshness(test.header, now); got != test.want {
+			t.Errorf("freshness(%v) = %v, want %v", test.header, got, test.want)
+		}
+	}
+}
+
+func TestInterval(t *testing.T) {
+	body := testCalendar("a")
+	server, requests := calendarServer(t, &body)
+	clock := newFakeClock()
+	cache := &Cache{Config: Config{URL: server.URL}, Interval: 10 * time.Minute}
+	cache.SetClock(clock.Now)
+
+	mustGet(t, cache)
+	clock.Advance(9 * time.Minute)
+	mustGet(t, cache)
+	if got := requests.Load(); got != 1 {
+		t.Fatalf("got %d requests within the interval", got)
+	}
+	clock.Advance(time.Minute)
+	mustGet(t, cache)
+	if got := requests.Load(); got != 2 {
+		t.Fatalf("got %d requests after the interval", got)
+	}
+}
+
+func TestExpiresWithoutDate(t *testing.T) {
+	clock := newFakeClock()
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header()["Date"] = nil // suppressed
+		w.Header().Set("Expires", clock.Now().Add(time.Hour).Format(http.TimeFormat))
+		io.WriteString(w, testCalendar("a"))
+	}))
+	defer server.Close()
+	cache := &Cache{Config: Config{URL: server.URL}, Interval: 10 * time.Minute}
+	cache.SetClock(clock.Now)
+
+	mustGet(t, cache)
+	clock.Advance(30 * time.Minute)
+	mustGet(t, cache)
+	if got := requests.Load(); got != 1 {
+		t.Fatalf("got %d requests although the response is fresh", got)
+	}
+	clock.Advance(30 * time.Minute)
+	mustGet(t, cache)
+	if got := requests.Load(); got != 2 {
+		t.Fatalf("got %d requests after the response has expired", got)
+	}
+}
+
+func TestLastModifiedEqual(t *testing.T) {
+	lastModified := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC).Format(http.TimeFormat)
+	var requests, notModified atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Last-Modified", lastModified)
+		if r.Header.Get("If-Modified-Since") == lastModified {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		io.WriteString(w, testCalendar("a"))
+	}))
+	defer server.Close()
+	clock := newFakeClock()
+	var changes int
+	cache := &Cache{Config: Config{URL: server.URL}, Interval: 10 * time.Minute, OnChange: func(old, new []Event) { changes++ }}
+	cache.SetClock(clock.Now)
+
+	first := mustGet(t, cache)
+	clock.Advance(10 * time.Minute)
+	second := mustGet(t, cache)
+	if requests.Load() != 2 || notModified.Load() != 1 {
+		t.Fatalf("got %d requests, %d not modified", requests.Load(), notModified.Load())
+	}
+	if &first[0] != &second[0] || changes != 1 || cache.Metrics().Parses != 1 {
+		t.Fatalf("unmodified data has been replaced: %d changes, %+v", changes, cache.Metrics())
+	}
+	if next := cache.NextCheck(); !next.Equal(clock.Now().Add(10 * time.Minute)) {
+		t.Fatalf("next check at %v, want interval after %v", next, clock.Now())
+	}
+}
+
+func TestJitter(t *testing.T) {
+	tests := []struct {
+		random float64
+		want   time.Duration
+	}{
+		{0, 9 * time.Minute},
+		{0.5, 10 * time.Minute},
+		{1, 11 * time.Minute},
+	}
+	for _, test := range tests {
+		body := testCalendar("a")
+		server, requests := calendarServer(t, &body)
+		clock := newFakeClock()
+		cache := &Cache{Config: Config{URL: server.URL}, Interval: 10 * time.Minute, Jitter: 0.1, Rand: func() float64 { return test.random }}
+		cache.SetClock(clock.Now)
+
+		start := clock.Now()
+		mustGet(t, cache)
+		if next := cache.NextCheck(); !next.Equal(start.Add(test.want)) {
+			t.Errorf("random %v: next check after %v, want %v", test.random, next.Sub(start), test.want)
+		}
+		clock.Advance(test.want - time.Second)
+		mustGet(t, cache)
+		clock.Advance(time.Second)
+		mustGet(t, cache)
+		if got := requests.Load(); got != 2 {
+			t.Errorf("random %v: got %d requests, want 2", test.random, got)
+		}
+	}
+}
+
+func TestJitterDisabled(t *testing.T) {
+	body := testCalendar("a")
+	server, _ := calendarServer(t, &body)
+	clock := newFakeClock()
+	cache := &Cache{Config: Config{URL: server.URL}, Interval: 10 * time.Minute, Rand: func() float64 { return 1 }}
+	cache.SetClock(clock.Now)
+	mustGet(t, cache)
+	if next := cache.NextCheck(); !next.Equal(clock.Now().Add(10 * time.Minute)) {
+		t.Fatalf("got next check %v without Jitter", next)
+	}
+}
+
+func TestAlwaysCheck(t *testing.T) {
+	upstream := &etagServer{version: "a"}
+	server := httptest.NewServer(upstream)
+	defer server.Close()
+	clock := newFakeClock()
+	cache := &Cache{Config: Config{URL: server.URL}, Interval: AlwaysCheck}
+	cache.SetClock(clock.Now)
+
+	for range 3 {
+		mustGet(t, cache) // the clock doesn't move
+	}
+	upstream.set("b")
+	if events := mustGet(t, cache); events[0].UID != "b" {
+		t.Fatalf("got %v", uids(events))
+	}
+	if len(upstream.ifNoneMatch) != 4 || upstream.fullRequests != 2 {
+		t.Fatalf("got %d requests, %d full", len(upstream.ifNoneMatch), upstream.fullRequests)
+	}
+	if metrics := cache.Metrics(); metrics.NotModified != 2 || metrics.Parses != 2 {
+		t.Fatalf("got %+v", metrics)
+	}
+}
+
+func TestShortIntervalRaised(t *testing.T) {
+	body := testCalendar("a")
+	server, requests := calendarServer(t, &body)
+	clock := newFakeClock()
+	var raised time.Duration
+	cache := &Cache{Config: Config{URL: server.URL}, Interval: time.Second, OnIntervalRaised: func(interval, min time.Duration) { raised = min }}
+	cache.SetClock(clock.Now)
+
+	mustGet(t, cache)
+	clock.Advance(10 * time.Second)
+	mustGet(t, cache)
+	if requests.Load() != 1 || raised != DefaultMinInterval {
+		t.Fatalf("got %d requests, raised to %v", requests.Load(), raised)
+	}
+}
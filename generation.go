@@ -0,0 +1,47 @@
+package icalcache
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"hash/fnv"
+	"slices"
+)
+
+// Generation returns a number which is incremented whenever the cached events are replaced with different ones, no matter whether the upstream modification timestamp or hash has changed. It is zero until events have been cached by a successful refresh, SetEvents or LoadSnapshot, or restored from CacheDir or Store, and it never decreases, not even by Invalidate. It does not wait for a running refresh.
+func (cache *Cache) Generation() uint64 {
+	return cache.generation.Load()
+}
+
+// sameGeneration reports whether the cached events equal the events of the current generation, regardless of their order, like the content hash of OnChange. The caller must hold the lock.
+func (cache *Cache) sameGeneration() bool {
+	a, b := cache.generationEvents, cache.events
+	if len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0]) {
+		return true // same slice, the cache never modifies it
+	}
+	return eventsHash(b) == cache.generationHash
+}
+
+// contentHash returns hashSum if HashRaw is set, else a hash of the events which doesn't depend on their order. The caller must hold the lock.
+func (cache *Cache) contentHash(events []Event, hashSum string) string {
+	if cache.HashRaw {
+		return hashSum
+	}
+	return eventsHash(events)
+}
+
+// eventsHash returns a hash of the events which doesn't depend on their order.
+func eventsHash(events []Event) string {
+	sums := make([]uint64, len(events))
+	for i, event := range events {
+		hash := fnv.New64()
+		json.NewEncoder(hash).Encode(event) // covers all fields
+		sums[i] = hash.Sum64()
+	}
+	slices.Sort(sums)
+	hash := fnv.New64()
+	for _, sum := range sums {
+		binary.Write(hash, binary.BigEndian, sum)
+	}
+	return base64.StdEncoding.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,91 @@
+package icalcache
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGeneration(t *testing.T) {
+	body, status := "", http.StatusInternalServerError
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	defer server.Close()
+	cache := &Cache{Config: Config{URL: server.URL}}
+
+	step := func(name string, want uint64) {
+		t.Helper()
+		cache.ForceRefresh(time.UTC)
+		if got := cache.Generation(); got != want {
+			t.Fatalf("%s: got generation %d, want %d", name, got, want)
+		}
+	}
+	step("failed first refresh", 0)
+	status, body = http.StatusOK, testCalendar()
+	step("empty calendar", 1)
+	body = testCalendar("a")
+	step("new events", 2)
+	step("same events", 2)
+	status = http.StatusInternalServerError
+	step("failed refresh", 2)
+	cache.Invalidate()
+	if got := cache.Generation(); got != 2 {
+		t.Fatalf("Invalidate: got generation %d", got)
+	}
+}
+
+func TestGenerationReordered(t *testing.T) {
+	body := testCalendar("a", "b")
+	server, _ := calendarServer(t, &body)
+	var changes int
+	cache := &Cache{Config: Config{URL: server.URL}, OnChange: func(old, new []Event) { changes++ }}
+	mustGet(t, cache)
+
+	// swap the two events
+	begin := strings.Index(body, "BEGIN:VEVENT")
+	second := strings.LastIndex(body, "BEGIN:VEVENT")
+	end := strings.Index(body, "END:VCALENDAR")
+	body = body[:begin] + body[second:end] + body[begin:second] + body[end:]
+	if events, _, err := cache.ForceRefresh(time.UTC); err != nil || uids(events)[0] != "b" {
+		t.Fatalf("got %v, %v", uids(events), err)
+	}
+	if got := cache.Generation(); got != 1 {
+		t.Fatalf("got generation %d for reordered events", got)
+	}
+	if changes != 1 {
+		t.Fatalf("got %d OnChange calls", changes)
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	for _, hashRaw := range []bool{false, true} {
+		t.Run(fmt.Sprintf("HashRaw=%v", hashRaw), func(t *testing.T) {
+			body := testCalendar("a", "b")
+			server, _ := calendarServer(t, &body)
+			var changes int
+			cache := &Cache{Config: Config{URL: server.URL}, HashRaw: hashRaw, OnChange: func(old, new []Event) { changes++ }}
+			mustGet(t, cache)
+
+			body = strings.ReplaceAll(body, "DTSTAMP:20240101T000000Z", "DTSTAMP:20240102T000000Z")
+			body = strings.Replace(body, "PRODID:-//test//test//EN", "PRODID:-//test//other//EN", 1)
+			cache.ForceRefresh(time.UTC)
+			if want := map[bool]int{false: 1, true: 2}[hashRaw]; changes != want {
+				t.Fatalf("got %d OnChange calls after a DTSTAMP and PRODID change, want %d", changes, want)
+			}
+
+			body = strings.Replace(body, "SUMMARY:Event a", "SUMMARY:Renamed", 1)
+			if _, _, err := cache.ForceRefresh(time.UTC); err != nil {
+				t.Fatal(err)
+			}
+			if want := map[bool]int{false: 2, true: 3}[hashRaw]; changes != want {
+				t.Fatalf("got %d OnChange calls after a SUMMARY change, want %d", changes, want)
+			}
+		})
+	}
+}
@@ -2,6 +2,9 @@ module github.com/wansing/go-ical-cache
 
 go 1.23.4
 
-require github.com/emersion/go-ical v0.0.0-20240127095438-fc1c9d8fb2b6
-
-require github.com/teambition/rrule-go v1.8.2 // indirect
+require (
+	github.com/emersion/go-ical v0.0.0-20240127095438-fc1c9d8fb2b6
+	github.com/teambition/rrule-go v1.8.2
+	golang.org/x/oauth2 v0.30.0
+	golang.org/x/text v0.28.0
+)
@@ -0,0 +1,112 @@
+package icalcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Group combines the events of several caches.
+type Group struct {
+	Caches map[string]*Cache // by calendar name
+}
+
+// GroupEvent is an event and the name of the calendar it belongs to.
+type GroupEvent struct {
+	Event
+	Calendar string
+}
+
+// GroupError contains the errors of the caches of a Group by calendar name.
+type GroupError map[string]error
+
+func (err GroupError) Error() string {
+	var messages []string
+	for _, name := range slices.Sorted(maps.Keys(err)) {
+		messages = append(messages, name+": "+err[name].Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (err GroupError) Unwrap() []error {
+	return slices.Collect(maps.Values(err))
+}
+
+// Get calls Get on all caches concurrently and returns their events sorted by start time, and the latest modification timestamp. If some caches fail, the events of the others are returned together with a GroupError.
+func (group *Group) Get(defaultLocation *time.Location) ([]GroupEvent, int64, error) {
+	return group.GetContext(context.Background(), defaultLocation)
+}
+
+// GetContext is like Get, see Cache.GetContext.
+func (group *Group) GetContext(ctx context.Context, defaultLocation *time.Location) ([]GroupEvent, int64, error) {
+	type result struct {
+		events       []Event
+		lastModified int64
+		err          error
+	}
+	names := slices.Sorted(maps.Keys(group.Caches))
+	results := make([]result, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			events, lastModified, err := group.Caches[name].GetContext(ctx, defaultLocation)
+			results[i] = result{events, lastModified, err}
+		}()
+	}
+	wg.Wait()
+
+	var events []GroupEvent
+	var lastModified int64
+	var errs = make(GroupError)
+	for i, name := range names {
+		for _, event := range results[i].events {
+			events = append(events, GroupEvent{event, name})
+		}
+		lastModified = max(lastModified, results[i].lastModified)
+		if results[i].err != nil {
+			errs[name] = results[i].err
+		}
+	}
+	slices.SortStableFunc(events, func(a, b GroupEvent) int {
+		return a.Start.Compare(b.Start)
+	})
+	if len(errs) > 0 {
+		return events, lastModified, errs
+	}
+	return events, lastModified, nil
+}
+
+// PrimeConcurrency is the maximum number of caches which Prime refreshes at the same time.
+const PrimeConcurrency = 8
+
+// Prime fetches the events of the given caches concurrently, for example on startup, and waits until all have finished or ctx is done. The errors are joined. Caches which have failed are usable and retry as usual.
+func Prime(ctx context.Context, defaultLocation *time.Location, caches ...*Cache) error {
+	var errs = make([]error, len(caches))
+	var sem = make(chan struct{}, PrimeConcurrency)
+	var wg sync.WaitGroup
+loop:
+	for i, cache := range caches {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break loop
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if _, _, err := cache.GetContext(ctx, defaultLocation); err != nil {
+				errs[i] = fmt.Errorf("cache %d: %w", i, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(append(errs, ctx.Err())...)
+}
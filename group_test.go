@@ -0,0 +1,132 @@
+package icalcache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroup(t *testing.T) {
+	work, home := testCalendar("w1", "w2"), testCalendar("h1")
+	workServer, _ := calendarServer(t, &work)
+	homeServer, _ := calendarServer(t, &home)
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer failing.Close()
+	group := &Group{Caches: map[string]*Cache{
+		"work":   {Config: Config{URL: workServer.URL}},
+		"home":   {Config: Config{URL: homeServer.URL}},
+		"broken": {Config: Config{URL: failing.URL}, Retries: -1},
+	}}
+
+	events, lastModified, err := group.Get(time.UTC)
+	var groupErr GroupError
+	if !errors.As(err, &groupErr) || len(groupErr) != 1 || !errors.Is(groupErr["broken"], ErrNotFound) {
+		t.Fatalf("got %v", err)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatal("the GroupError does not unwrap to the errors of the caches")
+	}
+	var got []string
+	for _, event := range events {
+		got = append(got, event.Calendar+"/"+event.UID)
+	}
+	// testCalendar starts the events on consecutive days
+	if want := []string{"home/h1", "work/w1", "work/w2"}; !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if lastModified == 0 {
+		t.Fatal("got no lastModified")
+	}
+}
+
+func TestGroupConcurrent(t *testing.T) {
+	body := testCalendar("a")
+	server, _ := calendarServer(t, &body)
+	group := &Group{Caches: map[string]*Cache{
+		"a": {Config: Config{URL: server.URL}, Interval: AlwaysCheck},
+		"b": {Config: Config{URL: server.URL}, Interval: AlwaysCheck},
+	}}
+	done := make(chan struct{})
+	for range 4 {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for range 20 {
+				if events, _, err := group.Get(time.UTC); err != nil || len(events) != 2 {
+					t.Errorf("got %v, %v", events, err)
+					return
+				}
+			}
+		}()
+	}
+	for range 4 {
+		<-done
+	}
+}
+
+func TestPrime(t *testing.T) {
+	var running, maxRunning, requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		io.WriteString(w, testCalendar("a"))
+	}))
+	defer server.Close()
+
+	caches := make([]*Cache, 3*PrimeConcurrency)
+	for i := range caches {
+		caches[i] = &Cache{Config: Config{URL: server.URL}}
+	}
+	if err := Prime(context.Background(), time.UTC, caches...); err != nil {
+		t.Fatal(err)
+	}
+	if got := maxRunning.Load(); got > PrimeConcurrency || got < 2 {
+		t.Fatalf("got %d concurrent refreshes", got)
+	}
+	for _, cache := range caches {
+		if cache.EventCount() != 1 {
+			t.Fatal("a cache has not been primed")
+		}
+	}
+	before := requests.Load()
+	for _, cache := range caches {
+		mustGet(t, cache)
+	}
+	if requests.Load() != before {
+		t.Fatal("Get has checked upstream again after Prime")
+	}
+}
+
+func TestPrimeErrors(t *testing.T) {
+	body := testCalendar("a")
+	good, _ := calendarServer(t, &body)
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer bad.Close()
+	err := Prime(context.Background(), time.UTC, &Cache{Config: Config{URL: good.URL}}, &Cache{Config: Config{URL: bad.URL}, Retries: -1})
+	if !errors.Is(err, ErrForbidden) {
+		t.Fatalf("got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Prime(ctx, time.UTC, &Cache{Config: Config{URL: good.URL}}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v with a canceled context", err)
+	}
+}
@@ -0,0 +1,55 @@
+package icalcache
+
+import (
+	"io"
+	"time"
+)
+
+// RequestInfo describes an upstream HTTP request. It is passed to Cache.OnRequest.
+type RequestInfo struct {
+	Method      string
+	URL         string        // with the password redacted
+	StatusCode  int           // zero if there was no response
+	Duration    time.Duration // including reading the response body
+	BytesRead   int64         // of the response body, after decompression
+	NotModified bool          // the response indicated that the cached events are still valid
+	Err         error
+}
+
+func (cache *Cache) report(info RequestInfo, start time.Time, err error) {
+	if cache.OnRequest == nil && cache.Logger == nil {
+		return
+	}
+	info.Duration = time.Since(start)
+	info.Err = err
+	if cache.Logger != nil {
+		cache.Logger.Debug("upstream request", "method", info.Method, "url", info.URL, "status", info.StatusCode, "duration", info.Duration, "bytes", info.BytesRead, "not-modified", info.NotModified, "error", err)
+	}
+	if cache.OnRequest != nil {
+		cache.OnRequest(info)
+	}
+}
+
+// reportingBody counts the bytes read and calls Cache.OnRequest and Cache.Logger on Close.
+type reportingBody struct {
+	io.ReadCloser
+	cache *Cache
+	info  RequestInfo
+	start time.Time
+	err   error // first read error except io.EOF
+}
+
+func (b *reportingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.info.BytesRead += int64(n)
+	if err != nil && err != io.EOF && b.err == nil {
+		b.err = err
+	}
+	return n, err
+}
+
+func (b *reportingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cache.report(b.info, b.start, b.err)
+	return err
+}
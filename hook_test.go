@@ -0,0 +1,43 @@
+package icalcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOnRequest(t *testing.T) {
+	etags := &etagServer{version: "a"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		etags.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	var infos []RequestInfo
+	url := strings.Replace(server.URL, "http://", "http://user:secret@", 1)
+	cache := &Cache{Config: Config{URL: url}, OnRequest: func(info RequestInfo) { infos = append(infos, info) }}
+	mustGet(t, cache)
+	if _, _, err := cache.ForceRefresh(time.UTC); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(infos) != 2 {
+		t.Fatalf("got %d calls, want 2", len(infos))
+	}
+	for i, info := range infos {
+		if info.Method != http.MethodGet || info.Duration < 10*time.Millisecond || info.Err != nil {
+			t.Fatalf("request %d: got %+v", i, info)
+		}
+		if strings.Contains(info.URL, "secret") || !strings.Contains(info.URL, server.Listener.Addr().String()) {
+			t.Fatalf("request %d: got url %s", i, info.URL)
+		}
+	}
+	if info := infos[0]; info.StatusCode != http.StatusOK || info.BytesRead != int64(len(testCalendar("a"))) || info.NotModified {
+		t.Fatalf("got %+v for the full response", info)
+	}
+	if info := infos[1]; info.StatusCode != http.StatusNotModified || info.BytesRead != 0 || !info.NotModified {
+		t.Fatalf("got %+v for the not modified response", info)
+	}
+}
@@ -0,0 +1,47 @@
+package icalcache
+
+import (
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+// horizon is the time window of PastHorizon and FutureHorizon. Zero times are unbounded.
+type horizon struct {
+	from, to time.Time
+}
+
+// horizon returns the window, relative to now. The caller must hold the lock.
+func (cache *Cache) horizon() horizon {
+	var h horizon
+	if cache.PastHorizon > 0 {
+		h.from = cache.now().Add(-cache.PastHorizon)
+	}
+	if cache.FutureHorizon > 0 {
+		h.to = cache.now().Add(cache.FutureHorizon)
+	}
+	return h
+}
+
+// contains reports whether e overlaps the window. A recurring event is kept if any of its occurrences does.
+func (h horizon) contains(event ical.Event, e Event, defaultLocation *time.Location) bool {
+	if !h.to.IsZero() && e.Start.After(h.to) {
+		return false // recurrences start even later
+	}
+	end := e.End
+	if end.Before(e.Start) {
+		end = e.Start
+	}
+	if h.from.IsZero() || !end.Before(h.from) {
+		return true
+	}
+	if e.RecurrenceSet == "" {
+		return false
+	}
+	rs, err := recurrenceRuleSet(event, e.ExceptionDates, defaultLocation) // parsed again, but only for recurring events of the past
+	if err != nil || rs == nil {
+		return true // makeEvent has succeeded, so this is not expected
+	}
+	next := rs.After(h.from.Add(-end.Sub(e.Start)), true) // first occurrence which ends after from
+	return !next.IsZero() && (h.to.IsZero() || !next.After(h.to))
+}
@@ -0,0 +1,55 @@
+package icalcache
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestHorizon(t *testing.T) {
+	event := func(uid, start, end, extra string) string {
+		return "BEGIN:VEVENT\r\nUID:" + uid + "\r\nDTSTAMP:20240101T000000Z\r\nDTSTART:" + start + "\r\nDTEND:" + end + "\r\n" + extra + "END:VEVENT\r\n"
+	}
+	body := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//test//EN\r\n" +
+		event("past", "20230601T100000Z", "20230601T110000Z", "") +
+		event("recent", "20231220T100000Z", "20231220T110000Z", "") +
+		event("ongoing", "20231201T100000Z", "20240201T100000Z", "") +
+		event("weekly", "20230102T100000Z", "20230102T110000Z", "RRULE:FREQ=WEEKLY\r\n") +
+		event("ended-weekly", "20230102T100000Z", "20230102T110000Z", "RRULE:FREQ=WEEKLY;COUNT=3\r\n") +
+		event("soon", "20240115T100000Z", "20240115T110000Z", "") +
+		event("far", "20250101T100000Z", "20250101T110000Z", "") +
+		"END:VCALENDAR\r\n"
+	server, _ := calendarServer(t, &body)
+
+	tests := []struct {
+		name         string
+		past, future time.Duration
+		want         []string
+	}{
+		{"unbounded", 0, 0, []string{"past", "recent", "ongoing", "weekly", "ended-weekly", "soon", "far"}},
+		{"past", 30 * 24 * time.Hour, 0, []string{"recent", "ongoing", "weekly", "soon", "far"}},
+		{"future", 0, 30 * 24 * time.Hour, []string{"past", "recent", "ongoing", "weekly", "ended-weekly", "soon"}},
+		{"both", 30 * 24 * time.Hour, 30 * 24 * time.Hour, []string{"recent", "ongoing", "weekly", "soon"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock := newFakeClock() // 2024-01-01 12:00 UTC
+			cache := &Cache{Config: Config{URL: server.URL}, PastHorizon: test.past, FutureHorizon: test.future}
+			cache.SetClock(clock.Now)
+			if got := uids(mustGet(t, cache)); !slices.Equal(got, test.want) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHorizonMaxEvents(t *testing.T) {
+	body := testCalendar("a", "b", "c") // on January 1st, 2nd and 3rd
+	server, _ := calendarServer(t, &body)
+	clock := newFakeClock()
+	cache := &Cache{Config: Config{URL: server.URL}, MaxEvents: 2, FutureHorizon: 30 * time.Hour}
+	cache.SetClock(clock.Now)
+	if got := uids(mustGet(t, cache)); !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("got %v, dropped events must not count towards MaxEvents", got)
+	}
+}
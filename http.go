@@ -0,0 +1,459 @@
+package icalcache
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultUserAgent is used if Config.UserAgent is empty. It is like "go-ical-cache/v1.2.3" if the module version is known.
+var DefaultUserAgent = defaultUserAgent()
+
+func defaultUserAgent() string {
+	const name = "go-ical-cache"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range append(info.Deps, &info.Main) {
+			if dep.Path == "github.com/wansing/go-ical-cache" && dep.Version != "" && dep.Version != "(devel)" {
+				return name + "/" + dep.Version
+			}
+		}
+	}
+	return name
+}
+
+// DefaultTimeout is used if Cache.Timeout is zero.
+const DefaultTimeout = 5 * time.Second
+
+// Errors which a StatusError matches with errors.Is, depending on its status code
+var (
+	ErrUnauthorized = errors.New("upstream authentication failed")
+	ErrForbidden    = errors.New("upstream access forbidden")
+	ErrNotFound     = errors.New("upstream calendar not found")
+)
+
+// StatusError is returned if upstream responds with a status code other than 2xx or 304.
+type StatusError struct {
+	StatusCode int
+	Status     string    // like "403 Forbidden"
+	RetryAfter time.Time // from the Retry-After header of a 429 or 503 response, upstream is not requested again before
+}
+
+func (err StatusError) Error() string {
+	if !err.RetryAfter.IsZero() {
+		return fmt.Sprintf("upstream returned %s, retry after %s", err.Status, err.RetryAfter.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("upstream returned %s", err.Status)
+}
+
+func (err StatusError) Is(target error) bool {
+	switch err.StatusCode {
+	case http.StatusUnauthorized:
+		return target == ErrUnauthorized
+	case http.StatusForbidden:
+		return target == ErrForbidden
+	case http.StatusNotFound, http.StatusGone:
+		return target == ErrNotFound
+	default:
+		return false
+	}
+}
+
+func checkStatus(resp *http.Response, now time.Time) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return StatusError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			RetryAfter: retryAfter(resp, now),
+		}
+	}
+	return nil
+}
+
+// retryAfter parses the Retry-After header of 429 and 503 responses, either in delta-seconds or HTTP-date form.
+func retryAfter(resp *http.Response, now time.Time) time.Time {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return time.Time{}
+	}
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return now.Add(time.Duration(seconds) * time.Second)
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t
+	}
+	return time.Time{}
+}
+
+// checkStatus is like the checkStatus function, but also suppresses further requests until the Retry-After time. The caller must hold the lock.
+func (cache *Cache) checkStatus(resp *http.Response) error {
+	err := checkStatus(resp, cache.now())
+	var statusErr StatusError
+	if errors.As(err, &statusErr) && !statusErr.RetryAfter.IsZero() {
+		cache.retryAfter = statusErr.RetryAfter
+	}
+	return err
+}
+
+// closeBody drains and closes a response body, so the underlying connection can be reused.
+func closeBody(body io.ReadCloser) {
+	io.Copy(io.Discard, io.LimitReader(body, 64*1024)) // don't drain large bodies, closing the connection is cheaper then
+	body.Close()
+}
+
+// rewriteWebcal replaces the webcal:// and webcals:// schemes of calendar subscription links with https://.
+func rewriteWebcal(url string) string {
+	for _, scheme := range []string{"webcal://", "webcals://"} {
+		if len(url) >= len(scheme) && strings.EqualFold(url[:len(scheme)], scheme) {
+			return "https://" + url[len(scheme):]
+		}
+	}
+	return url
+}
+
+// credentials returns the config with the given URL, and webcal and userinfo resolved, so credentials don't end up in requests URLs and error messages.
+func (cache *Cache) credentials(rawURL string) (Config, error) {
+	config := cache.Config
+	config.URL = rawURL
+	config, err := config.splitUserinfo()
+	config.URL = rewriteWebcal(config.URL)
+	return config, err
+}
+
+// newRequest creates an upstream request with credentials and custom headers. An Authorization header in Config.Headers takes precedence over OAuth2, Token, Username and Password.
+func (cache *Cache) newRequest(ctx context.Context, method, rawURL string, body io.Reader) (*http.Request, error) {
+	config, err := cache.credentials(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if config.Username != "" && cache.Config.AuthScheme == AuthDigest {
+		ctx = context.WithValue(ctx, digestCredentials{}, url.UserPassword(config.Username, config.Password))
+	}
+	req, err := http.NewRequestWithContext(ctx, method, config.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case cache.Config.OAuth2.TokenURL != "":
+		token, err := cache.oauth2Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+		token.SetAuthHeader(req)
+	case cache.Config.Token != "":
+		req.Header.Set("Authorization", "Bearer "+cache.Config.Token)
+	case config.Username != "" && cache.Config.AuthScheme != AuthDigest: // digest is done in cache.do
+		req.SetBasicAuth(config.Username, config.Password)
+	}
+	if cache.Config.UserAgent != "" {
+		req.Header.Set("User-Agent", cache.Config.UserAgent)
+	} else {
+		req.Header.Set("User-Agent", DefaultUserAgent)
+	}
+	for key, value := range cache.Config.Headers {
+		req.Header.Set(key, value)
+	}
+	return req, nil
+}
+
+func (cache *Cache) timeout() time.Duration {
+	if cache.Timeout > 0 {
+		return cache.Timeout
+	}
+	return DefaultTimeout
+}
+
+func (cache *Cache) headTimeout() time.Duration {
+	if cache.HeadTimeout > 0 {
+		return cache.HeadTimeout
+	}
+	return cache.timeout()
+}
+
+func (cache *Cache) getTimeout() time.Duration {
+	if cache.GetTimeout > 0 {
+		return cache.GetTimeout
+	}
+	return cache.timeout()
+}
+
+// refreshTimeout returns the maximum duration of the requests to one mirror.
+func (cache *Cache) refreshTimeout() time.Duration {
+	if cache.HeadRequest {
+		return cache.headTimeout() + cache.getTimeout()
+	}
+	return cache.getTimeout()
+}
+
+// fetchHTTP gets the calendar from an HTTP upstream. The caller must hold the lock.
+func (cache *Cache) fetchHTTP(ctx context.Context) (io.ReadCloser, time.Time, bool, error) {
+	return cache.fetchMirrors(ctx, cache.fetchHTTPUpstream)
+}
+
+// fetchMirrors calls fetch with the mirror which succeeded last time first, then with the others in order. The caller must hold the lock.
+func (cache *Cache) fetchMirrors(ctx context.Context, fetch func(ctx context.Context, rawURL string) (io.ReadCloser, time.Time, bool, error)) (io.ReadCloser, time.Time, bool, error) {
+	urls := cache.urls()
+	if cache.mirror >= len(urls) {
+		cache.mirror = 0
+	}
+	var errs []error
+	for i := range urls {
+		mirror := (cache.mirror + i) % len(urls)
+		body, lastModified, notModified, err := fetch(ctx, urls[mirror])
+		if err == nil {
+			cache.mirror = mirror
+			return body, lastModified, notModified, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil || !isFailover(err) {
+			break
+		}
+	}
+	return nil, time.Time{}, false, errors.Join(errs...)
+}
+
+// isFailover reports whether the next mirror should be tried after err: on connection errors, timeouts and 5xx status codes.
+func isFailover(err error) bool {
+	var statusErr StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// fetchHTTPUpstream requests one mirror. The HEAD request gets HeadTimeout, the GET request and reading its body get GetTimeout.
+func (cache *Cache) fetchHTTPUpstream(ctx context.Context, rawURL string) (io.ReadCloser, time.Time, bool, error) {
+	// HTTP HEAD upstream, if enabled and supported
+	var httpLastModified time.Time
+	var head = cache.HeadRequest && !cache.headUnsupported
+	if head {
+		headCtx, cancel := context.WithTimeout(ctx, cache.headTimeout())
+		t, notModified, supported, err := cache.head(headCtx, rawURL)
+		cancel()
+		if err != nil || notModified {
+			return nil, time.Time{}, notModified, err
+		}
+		httpLastModified = t
+		head = supported
+	}
+
+	// HTTP GET upstream, conditional unless a HEAD request has been done
+	ctx, cancel := context.WithTimeout(ctx, cache.getTimeout())
+	var success = false
+	defer func() {
+		if !success {
+			cancel()
+		}
+	}()
+	ctx, span := cache.startSpan(ctx, "icalcache.GET") // ends with the response headers, reading the body is part of the fetch span
+	req, err := cache.newRequest(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		err = fmt.Errorf("making upstream request: %w", err)
+		span.End(err)
+		return nil, time.Time{}, false, err
+	}
+	if !head {
+		if cache.lastETag != "" {
+			req.Header.Set("If-None-Match", cache.lastETag)
+		}
+		if cache.lastHTTPLastModified != "" {
+			req.Header.Set("If-Modified-Since", cache.lastHTTPLastModified)
+		}
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	info := RequestInfo{Method: req.Method, URL: req.URL.Redacted()}
+	start := time.Now()
+	resp, err := cache.doRetry(req)
+	if err != nil {
+		err = fmt.Errorf("getting upstream data: %w", err)
+		cache.report(info, start, err)
+		span.End(err)
+		return nil, time.Time{}, false, err
+	}
+	info.StatusCode = resp.StatusCode
+	span.SetAttribute("http.response.status_code", resp.StatusCode)
+
+	// skip if upstream says that our ETag or Last-Modified value is still valid
+	if resp.StatusCode == http.StatusNotModified {
+		cache.freshness = freshness(resp.Header, cache.now())
+		closeBody(resp.Body)
+		info.NotModified = true
+		cache.report(info, start, nil)
+		span.SetAttribute("icalcache.not_modified", true)
+		span.End(nil)
+		return nil, time.Time{}, true, nil
+	}
+	if err := cache.checkStatus(resp); err != nil {
+		closeBody(resp.Body)
+		err = fmt.Errorf("getting upstream data: %w", err)
+		cache.report(info, start, err)
+		span.End(err)
+		return nil, time.Time{}, false, err
+	}
+	span.End(nil)
+
+	// use the Last-Modified header of the GET response if there was no HEAD request or its response had none
+	if httpLastModified.IsZero() {
+		if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+			httpLastModified = t
+		} else if resp.Header.Get("Last-Modified") != "" && cache.Logger != nil {
+			cache.Logger.Warn("ignoring invalid Last-Modified header", "value", resp.Header.Get("Last-Modified"))
+		}
+	}
+	body, err := cache.responseBody(resp)
+	if err != nil {
+		cache.report(info, start, err)
+		return nil, time.Time{}, false, err
+	}
+
+	cache.lastETag = resp.Header.Get("ETag")
+	cache.lastHTTPLastModified = resp.Header.Get("Last-Modified")
+	cache.freshness = freshness(resp.Header, cache.now())
+	if cache.OnRequest != nil || cache.Logger != nil {
+		body = &reportingBody{ReadCloser: body, cache: cache, info: info, start: start}
+	}
+	success = true // cancel on close
+	return bodyCloser{body, cancel}, httpLastModified, false, nil
+}
+
+// responseBody returns the decompressed and transcoded body of a GET response, and checks that it looks like iCalendar data unless SkipContentCheck is set. On error, it closes the body.
+func (cache *Cache) responseBody(resp *http.Response) (io.ReadCloser, error) {
+	return responseBody(resp, cache.SkipContentCheck)
+}
+
+func responseBody(resp *http.Response, skipContentCheck bool) (io.ReadCloser, error) {
+	body, err := decodeContent(resp)
+	if err != nil {
+		closeBody(resp.Body)
+		return nil, fmt.Errorf("getting upstream data: %w", err)
+	}
+	transcoded, err := transcode(body, resp.Header.Get("Content-Type"))
+	if err != nil {
+		closeBody(body)
+		return nil, fmt.Errorf("getting upstream data: %w", err)
+	}
+	body = transcoded
+	if !skipContentCheck {
+		sniffed, err := sniffICalendar(body, resp.Header.Get("Content-Type"))
+		if err != nil {
+			closeBody(body)
+			return nil, err
+		}
+		body = sniffed
+	}
+	return body, nil
+}
+
+// head does a HEAD request and reports whether upstream has not been modified since cache.lastModified, or still has the ETag of the last GET. If upstream does not support HEAD, supported is false and this is remembered. The caller must hold the lock.
+func (cache *Cache) head(ctx context.Context, rawURL string) (lastModified time.Time, notModified bool, supported bool, err error) {
+	ctx, span := cache.startSpan(ctx, "icalcache.HEAD")
+	defer func() {
+		span.SetAttribute("icalcache.not_modified", notModified)
+		span.End(err)
+	}()
+	req, err := cache.newRequest(ctx, http.MethodHead, rawURL, nil)
+	if err != nil {
+		return time.Time{}, false, false, fmt.Errorf("making upstream header request: %w", err)
+	}
+	info := RequestInfo{Method: req.Method, URL: req.URL.Redacted()}
+	start := time.Now()
+	resp, err := cache.do(req)
+	if err != nil {
+		err = fmt.Errorf("getting upstream headers: %w", err)
+		cache.report(info, start, err)
+		return time.Time{}, false, false, err
+	}
+	closeBody(resp.Body)
+	info.StatusCode = resp.StatusCode
+	span.SetAttribute("http.response.status_code", resp.StatusCode)
+
+	switch resp.StatusCode {
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		// fall through to a conditional GET, now and in subsequent refreshes
+		cache.headUnsupported = true
+		cache.report(info, start, nil)
+		return time.Time{}, false, false, nil
+	default:
+		if err := cache.checkStatus(resp); err != nil {
+			err = fmt.Errorf("getting upstream headers: %w", err)
+			cache.report(info, start, err)
+			return time.Time{}, false, false, err
+		}
+	}
+
+	// skip if upstream has the ETag of the last GET response, for servers which send no Last-Modified header (like Google Calendar)
+	if etag := resp.Header.Get("ETag"); etag != "" && etag == cache.lastETag {
+		info.NotModified = true
+		cache.report(info, start, nil)
+		return time.Time{}, true, true, nil
+	}
+
+	// skip if upstream has a Last-Modified header whose value is older
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		if t.Unix() <= cache.lastModified { // http timestamp before or equal cache timestamp
+			info.NotModified = true
+			cache.report(info, start, nil)
+			return time.Time{}, true, true, nil
+		}
+		lastModified = t
+	}
+	cache.report(info, start, nil)
+	return lastModified, false, true, nil
+}
+
+// decodeContent returns the decompressed response body. Because we set the Accept-Encoding header ourselves, the http package does not decompress it. The decompressed bytes are hashed, so the hash does not depend on whether upstream compressed the response.
+func decodeContent(resp *http.Response) (io.ReadCloser, error) {
+	switch encoding := strings.ToLower(resp.Header.Get("Content-Encoding")); encoding {
+	case "", "identity":
+		return resp.Body, nil
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("decompressing upstream data: %w", err)
+		}
+		return gzipBody{gz, resp.Body}, nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %s", encoding)
+	}
+}
+
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (g gzipBody) Close() error {
+	g.Reader.Close()
+	closeBody(g.body)
+	return nil
+}
+
+// bodyCloser drains the response body on Close and then cancels its request context.
+type bodyCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b bodyCloser) Close() error {
+	closeBody(b.ReadCloser)
+	b.cancel()
+	return nil
+}
+
+// resetValidators forgets the ETag and Last-Modified values, so the next request is unconditional.
+func (cache *Cache) resetValidators() {
+	cache.lastETag = ""
+	cache.lastHTTPLastModified = ""
+	cache.lastCTag = ""
+	cache.syncToken = ""
+	cache.syncResources = nil
+}
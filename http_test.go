@@ -0,0 +1,770 @@
+package icalcache
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// etagServer serves body with an ETag derived from version and answers matching If-None-Match headers with 304. It records the If-None-Match headers.
+type etagServer struct {
+	sync.Mutex
+	version      string
+	ifNoneMatch  []string
+	fullRequests int
+}
+
+func (s *etagServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	s.ifNoneMatch = append(s.ifNoneMatch, r.Header.Get("If-None-Match"))
+	etag := `"` + s.version + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	s.fullRequests++
+	io.WriteString(w, testCalendar(s.version))
+}
+
+func (s *etagServer) set(version string) {
+	s.Lock()
+	s.version = version
+	s.Unlock()
+}
+
+func TestConditionalGet(t *testing.T) {
+	upstream := &etagServer{version: "a"}
+	server := httptest.NewServer(upstream)
+	defer server.Close()
+	clock := newFakeClock()
+	cache := &Cache{Config: Config{URL: server.URL}}
+	cache.SetClock(clock.Now)
+
+	get := func(want string) []Event {
+		t.Helper()
+		clock.Advance(time.Hour)
+		events := mustGet(t, cache)
+		if got := uids(events); len(got) != 1 || got[0] != want {
+			t.Fatalf("got %v, want %s", got, want)
+		}
+		return events
+	}
+	first := get("a")
+	if second := get("a"); &first[0] != &second[0] {
+		t.Fatal("events have been replaced after 304")
+	}
+	upstream.set("b")
+	get("b")
+	get("b")
+	upstream.set("a") // alternates back
+	get("a")
+
+	want := []string{"", `"a"`, `"a"`, `"b"`, `"b"`}
+	if len(upstream.ifNoneMatch) != len(want) {
+		t.Fatalf("got If-None-Match %q, want %q", upstream.ifNoneMatch, want)
+	}
+	for i := range want {
+		if upstream.ifNoneMatch[i] != want[i] {
+			t.Fatalf("got If-None-Match %q, want %q", upstream.ifNoneMatch, want)
+		}
+	}
+	if metrics := cache.Metrics(); metrics.Parses != 3 || metrics.NotModified != 2 || upstream.fullRequests != 3 {
+		t.Fatalf("got %d full requests, %+v", upstream.fullRequests, metrics)
+	}
+}
+
+// countingListener counts the accepted connections.
+type countingListener struct {
+	net.Listener
+	accepted atomic.Int64
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.accepted.Add(1)
+	}
+	return conn, err
+}
+
+func TestConnectionReuse(t *testing.T) {
+	var status atomic.Int64
+	status.Store(http.StatusOK)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"a"`)
+		if r.Header.Get("If-None-Match") == `"a"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(int(status.Load()))
+		io.WriteString(w, testCalendar("a"))
+	}))
+	listener := &countingListener{Listener: server.Listener}
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{}}
+	defer client.CloseIdleConnections()
+	cache := &Cache{Config: Config{URL: server.URL}, Client: client}
+	for _, s := range []int{http.StatusOK, http.StatusOK, http.StatusInternalServerError, http.StatusNotFound, http.StatusOK} {
+		status.Store(int64(s))
+		cache.resetValidators() // alternate between full responses and 304
+		cache.ForceRefresh(time.UTC)
+		cache.ForceRefresh(time.UTC)
+	}
+	cache.HeadRequest = true
+	cache.ForceRefresh(time.UTC)
+	if got := listener.accepted.Load(); got != 1 {
+		t.Fatalf("got %d connections, want 1", got)
+	}
+}
+
+// headerServer serves a calendar and records the last request headers.
+func headerServer(t *testing.T) (*httptest.Server, func() http.Header) {
+	var lock sync.Mutex
+	var last http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		last = r.Header.Clone()
+		lock.Unlock()
+		io.WriteString(w, testCalendar("a"))
+	}))
+	t.Cleanup(server.Close)
+	return server, func() http.Header {
+		lock.Lock()
+		defer lock.Unlock()
+		return last
+	}
+}
+
+func TestCustomHeaders(t *testing.T) {
+	server, last := headerServer(t)
+	tests := []struct {
+		config            Config
+		wantAuthorization string
+	}{
+		{Config{Headers: map[string]string{"X-Api-Key": "key"}}, ""},
+		{Config{Token: "token"}, "Bearer token"},
+		{Config{Token: "token", Headers: map[string]string{"Authorization": "Custom header"}}, "Custom header"},
+		{Config{Username: "alice", Password: "secret"}, "Basic YWxpY2U6c2VjcmV0"},
+		{Config{Username: "alice", Password: "secret", Headers: map[string]string{"authorization": "Custom header"}}, "Custom header"},
+	}
+	for _, test := range tests {
+		test.config.URL = server.URL
+		cache := &Cache{Config: test.config}
+		mustGet(t, cache)
+		header := last()
+		if got := header.Get("Authorization"); got != test.wantAuthorization {
+			t.Errorf("%+v: got Authorization %q, want %q", test.config, got, test.wantAuthorization)
+		}
+		for key, value := range test.config.Headers {
+			if got := header.Get(key); got != value {
+				t.Errorf("%+v: got %s %q", test.config, key, got)
+			}
+		}
+	}
+}
+
+func TestGzip(t *testing.T) {
+	body := testCalendar("a", "b")
+	var gzipped atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gzip" && strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			gzipped.Add(1)
+			w.Header().Set("Content-Encoding", "gzip")
+			zw := gzip.NewWriter(w)
+			io.WriteString(zw, body)
+			zw.Close()
+			return
+		}
+		io.WriteString(w, body)
+	}))
+	defer server.Close()
+
+	plain := &Cache{Config: Config{URL: server.URL + "/plain"}, KeepRaw: true}
+	compressed := &Cache{Config: Config{URL: server.URL + "/gzip"}, KeepRaw: true}
+	mustGet(t, plain)
+	if events := mustGet(t, compressed); len(events) != 2 {
+		t.Fatalf("got %v", uids(events))
+	}
+	if gzipped.Load() != 1 {
+		t.Fatal("upstream has not compressed the response")
+	}
+	if plain.lastHashSum == "" || plain.lastHashSum != compressed.lastHashSum {
+		t.Fatalf("got hash %q and %q", plain.lastHashSum, compressed.lastHashSum)
+	}
+	if raw, _ := compressed.Raw(); string(raw) != body {
+		t.Fatalf("got raw %q", raw)
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	server, last := headerServer(t)
+	mustGet(t, &Cache{Config: Config{URL: server.URL}})
+	if got := last().Get("User-Agent"); got != DefaultUserAgent || !strings.HasPrefix(got, "go-ical-cache") {
+		t.Fatalf("got User-Agent %q, want %q", got, DefaultUserAgent)
+	}
+	mustGet(t, &Cache{Config: Config{URL: server.URL, UserAgent: "calendar-bot/1.0 (admin@example.com)"}})
+	if got := last().Get("User-Agent"); got != "calendar-bot/1.0 (admin@example.com)" {
+		t.Fatalf("got User-Agent %q", got)
+	}
+}
+
+func TestHeadNotAllowed(t *testing.T) {
+	var heads, gets atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			heads.Add(1)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		gets.Add(1)
+		io.WriteString(w, testCalendar("a"))
+	}))
+	defer server.Close()
+	cache := &Cache{Config: Config{URL: server.URL, HeadRequest: true}}
+
+	for range 3 {
+		if _, _, err := cache.ForceRefresh(time.UTC); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if heads.Load() != 1 || gets.Load() != 3 {
+		t.Fatalf("got %d HEAD and %d GET requests, want 1 and 3", heads.Load(), gets.Load())
+	}
+	cache.Invalidate()
+	mustGet(t, cache)
+	if heads.Load() != 2 {
+		t.Fatal("Invalidate has not forgotten the rejected HEAD")
+	}
+}
+
+func TestSeparateTimeouts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delay, _ := time.ParseDuration(r.URL.Query().Get(r.Method))
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		io.WriteString(w, testCalendar("a"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		headDelay, getDelay time.Duration
+		headTimeout         time.Duration
+		getTimeout          time.Duration
+		wantErr             bool
+	}{
+		{100 * time.Millisecond, 0, 20 * time.Millisecond, time.Second, true},
+		{0, 100 * time.Millisecond, 20 * time.Millisecond, time.Second, false}, // the slow GET has its own timeout
+		{0, 100 * time.Millisecond, time.Second, 20 * time.Millisecond, true},
+	}
+	for _, test := range tests {
+		url := fmt.Sprintf("%s?HEAD=%v&GET=%v", server.URL, test.headDelay, test.getDelay)
+		cache := &Cache{Config: Config{URL: url, HeadRequest: true}, HeadTimeout: test.headTimeout, GetTimeout: test.getTimeout}
+		_, _, err := cache.Get(time.UTC)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%+v: got error %v", test, err)
+		}
+		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%+v: got error %v, want deadline exceeded", test, err)
+		}
+	}
+}
+
+func TestIntervalExceedsTimeouts(t *testing.T) {
+	tests := []struct {
+		headRequest bool
+		wantErr     bool
+	}{
+		{false, false}, // only GetTimeout counts
+		{true, true},
+	}
+	for _, test := range tests {
+		_, err := NewCache(Config{URL: "https://example.com/cal.ics", HeadRequest: test.headRequest}, WithInterval(time.Minute), func(cache *Cache) {
+			cache.HeadTimeout = 40 * time.Second
+			cache.GetTimeout = 30 * time.Second
+		})
+		if (err != nil) != test.wantErr {
+			t.Errorf("HeadRequest=%v: got error %v", test.headRequest, err)
+		}
+	}
+}
+
+func TestLastModifiedFormats(t *testing.T) {
+	want := time.Date(1994, 11, 6, 8, 49, 37, 0, time.UTC)
+	tests := []struct {
+		header string
+		valid  bool
+	}{
+		{"Sun, 06 Nov 1994 08:49:37 GMT", true},  // RFC 1123
+		{"Sunday, 06-Nov-94 08:49:37 GMT", true}, // RFC 850
+		{"Sun Nov  6 08:49:37 1994", true},       // asctime
+		{"1994-11-06T08:49:37Z", false},
+		{"yesterday", false},
+	}
+	for _, test := range tests {
+		t.Run(test.header, func(t *testing.T) {
+			var lock sync.Mutex
+			var ifModifiedSince []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				lock.Lock()
+				ifModifiedSince = append(ifModifiedSince, r.Header.Get("If-Modified-Since"))
+				lock.Unlock()
+				w.Header().Set("Last-Modified", test.header)
+				io.WriteString(w, testCalendar("a"))
+			}))
+			defer server.Close()
+			clock := newFakeClock()
+			cache := &Cache{Config: Config{URL: server.URL}}
+			cache.SetClock(clock.Now)
+
+			_, lastModified, err := cache.Get(time.UTC)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.valid && lastModified != want.Unix() {
+				t.Fatalf("got last modified %v, want %v", time.Unix(lastModified, 0).UTC(), want)
+			}
+			if !test.valid && lastModified != clock.Now().Unix() {
+				t.Fatalf("got last modified %v, want the time of the refresh", time.Unix(lastModified, 0).UTC())
+			}
+			clock.Advance(time.Hour)
+			mustGet(t, cache)
+			if got := ifModifiedSince; got[0] != "" || got[1] != test.header {
+				t.Fatalf("got If-Modified-Since %q", got)
+			}
+		})
+	}
+}
+
+func TestResetValidators(t *testing.T) {
+	tests := []struct {
+		name        string
+		second      string // body of the second response
+		wantHeaders bool   // in the third request
+	}{
+		{"unchanged", testCalendar("a"), true},
+		{"parse error", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART:invalid\r\n", false},
+		{"empty calendar", testCalendar(), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var lock sync.Mutex
+			var requests []http.Header
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				lock.Lock()
+				requests = append(requests, r.Header.Clone())
+				n := len(requests)
+				lock.Unlock()
+				w.Header().Set("ETag", fmt.Sprintf(`"%d"`, n))
+				w.Header().Set("Last-Modified", time.Unix(int64(n)*3600, 0).UTC().Format(http.TimeFormat))
+				body := testCalendar("a")
+				if n == 2 {
+					body = test.second
+				}
+				io.WriteString(w, body)
+			}))
+			defer server.Close()
+			cache := &Cache{Config: Config{URL: server.URL}}
+			for range 3 {
+				cache.ForceRefresh(time.UTC)
+			}
+			third := requests[2]
+			if got := third.Get("If-None-Match") == `"2"` && third.Get("If-Modified-Since") == time.Unix(7200, 0).UTC().Format(http.TimeFormat); got != test.wantHeaders {
+				t.Fatalf("got If-None-Match %q and If-Modified-Since %q", third.Get("If-None-Match"), third.Get("If-Modified-Since"))
+			}
+			if !test.wantHeaders && (third.Get("If-None-Match") != "" || third.Get("If-Modified-Since") != "") {
+				t.Fatalf("validators have not been reset: %v", third)
+			}
+		})
+	}
+}
+
+// statusServer serves a calendar until status is set to another code than 200.
+func statusServer(t *testing.T) (*httptest.Server, *atomic.Int64) {
+	var status atomic.Int64
+	status.Store(http.StatusOK)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if code := int(status.Load()); code != http.StatusOK {
+			w.WriteHeader(code)
+			io.WriteString(w, "<html>error</html>")
+			return
+		}
+		io.WriteString(w, testCalendar("a"))
+	}))
+	t.Cleanup(server.Close)
+	return server, &status
+}
+
+func TestStatusCodes(t *testing.T) {
+	server, status := statusServer(t)
+	cache := &Cache{Config: Config{URL: server.URL}, Retries: -1}
+	mustGet(t, cache)
+
+	for _, code := range []int{http.StatusInternalServerError, http.StatusBadRequest, http.StatusTeapot} {
+		status.Store(int64(code))
+		events, _, err := cache.ForceRefresh(time.UTC)
+		var statusErr StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != code {
+			t.Fatalf("%d: got %v", code, err)
+		}
+		if len(events) != 1 {
+			t.Fatalf("%d: got %v, want the cached events", code, events)
+		}
+	}
+}
+
+func TestGetContextCanceled(t *testing.T) {
+	var slow atomic.Bool
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slow.Load() {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}
+		io.WriteString(w, testCalendar("a"))
+	}))
+	defer server.Close()
+	defer close(release)
+	clock := newFakeClock()
+	cache := &Cache{Config: Config{URL: server.URL}}
+	cache.SetClock(clock.Now)
+	mustGet(t, cache)
+
+	slow.Store(true)
+	clock.Advance(time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	events, _, err := cache.GetContext(ctx, time.UTC)
+	if !errors.Is(err, context.DeadlineExceeded) || len(events) != 1 {
+		t.Fatalf("got %v, %v, want the cached events and the context error", events, err)
+	}
+	if err, _ := cache.LastError(); err != nil {
+		t.Fatalf("the canceled call has been recorded as a failure: %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := cache.ForceRefreshContext(ctx, time.UTC); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v with a canceled context", err)
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	server, header := headerServer(t)
+	mustGet(t, &Cache{Config: Config{URL: server.URL, Token: "s3cret"}})
+	if got := header().Get("Authorization"); got != "Bearer s3cret" {
+		t.Fatalf("got Authorization %q", got)
+	}
+
+	if _, err := NewCache(Config{URL: server.URL, Token: "s3cret", Username: "user"}); err == nil {
+		t.Fatal("NewCache has accepted a token together with a username")
+	}
+}
+
+func TestWebcal(t *testing.T) {
+	for url, want := range map[string]string{
+		"webcal://example.com/cal.ics":  "https://example.com/cal.ics",
+		"WEBCAL://example.com/cal.ics":  "https://example.com/cal.ics",
+		"webcals://example.com/cal.ics": "https://example.com/cal.ics",
+		"http://example.com/cal.ics":    "http://example.com/cal.ics",
+		"webcal:":                       "webcal:",
+	} {
+		if got := rewriteWebcal(url); got != want {
+			t.Errorf("%s: got %s, want %s", url, got, want)
+		}
+	}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, testCalendar("a"))
+	}))
+	defer server.Close()
+	cache := &Cache{Config: Config{URL: strings.Replace(server.URL, "https://", "webcal://", 1)}, Client: server.Client()}
+	if events := mustGet(t, cache); len(events) != 1 {
+		t.Fatalf("got %v", events)
+	}
+}
+
+// flakyServer answers the first failures requests with status and the others with a calendar. It counts the requests.
+func flakyServer(t *testing.T, failures int, status int, retryAfter string) (*httptest.Server, *atomic.Int64) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= int64(failures) {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(status)
+			return
+		}
+		io.WriteString(w, testCalendar("a"))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		retries    int
+		failures   int
+		status     int
+		retryAfter string
+		requests   int64
+		ok         bool
+	}{
+		{"transient", 0, 2, http.StatusServiceUnavailable, "", 3, true},
+		{"too many", 0, 3, http.StatusBadGateway, "", 3, false},
+		{"more retries", 3, 3, http.StatusGatewayTimeout, "", 4, true},
+		{"disabled", -1, 1, http.StatusServiceUnavailable, "", 1, false},
+		{"not transient", 0, 1, http.StatusInternalServerError, "", 1, false},
+		{"retry after", 0, 1, http.StatusServiceUnavailable, "120", 1, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, requests := flakyServer(t, test.failures, test.status, test.retryAfter)
+			_, _, err := (&Cache{Config: Config{URL: server.URL}, Retries: test.retries}).Get(time.UTC)
+			if (err == nil) != test.ok || requests.Load() != test.requests {
+				t.Fatalf("got %v after %d requests", err, requests.Load())
+			}
+		})
+	}
+}
+
+func TestRetriesCanceled(t *testing.T) {
+	server, requests := flakyServer(t, 100, http.StatusServiceUnavailable, "")
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond) // the second backoff is 200ms
+	defer cancel()
+	_, _, err := (&Cache{Config: Config{URL: server.URL}, Retries: 10}).GetContext(ctx, time.UTC)
+	if err == nil || requests.Load() != 2 {
+		t.Fatalf("got %v after %d requests", err, requests.Load())
+	}
+}
+
+func TestStatusErrors(t *testing.T) {
+	server, status := statusServer(t)
+	cache := &Cache{Config: Config{URL: server.URL}, Retries: -1}
+	tests := []struct {
+		code int
+		want error
+	}{
+		{http.StatusUnauthorized, ErrUnauthorized},
+		{http.StatusForbidden, ErrForbidden},
+		{http.StatusNotFound, ErrNotFound},
+		{http.StatusGone, ErrNotFound},
+	}
+	for _, test := range tests {
+		status.Store(int64(test.code))
+		_, _, err := cache.ForceRefresh(time.UTC)
+		if !errors.Is(err, test.want) {
+			t.Fatalf("%d: got %v, want %v", test.code, err, test.want)
+		}
+		for _, other := range []error{ErrUnauthorized, ErrForbidden, ErrNotFound} {
+			if other != test.want && errors.Is(err, other) {
+				t.Fatalf("%d: %v matches %v", test.code, err, other)
+			}
+		}
+	}
+	status.Store(http.StatusInternalServerError)
+	_, _, err := cache.ForceRefresh(time.UTC)
+	if errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrForbidden) || errors.Is(err, ErrNotFound) {
+		t.Fatalf("500 matches a typed error: %v", err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	clock := newFakeClock()
+	tests := []struct {
+		name  string
+		value string
+		wait  time.Duration
+	}{
+		{"delta seconds", "120", 2 * time.Minute},
+		{"http date", clock.Now().Add(10 * time.Minute).Format(http.TimeFormat), 10 * time.Minute},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, requests := flakyServer(t, 1, http.StatusServiceUnavailable, test.value)
+			clock := newFakeClock()
+			cache := &Cache{Config: Config{URL: server.URL}, Interval: time.Second, Retries: -1}
+			cache.SetClock(clock.Now)
+
+			_, _, err := cache.Get(time.UTC)
+			var statusErr StatusError
+			if !errors.As(err, &statusErr) || !statusErr.RetryAfter.Equal(clock.Now().Add(test.wait)) {
+				t.Fatalf("got %v, want retry after %v", err, test.wait)
+			}
+			clock.Advance(test.wait - time.Second)
+			cache.Get(time.UTC)
+			if got := requests.Load(); got != 1 {
+				t.Fatalf("got %d requests before Retry-After", got)
+			}
+			clock.Advance(2 * time.Second)
+			if events := mustGet(t, cache); len(events) != 1 {
+				t.Fatalf("got %v after Retry-After", events)
+			}
+			if got := requests.Load(); got != 2 {
+				t.Fatalf("got %d requests, want 2", got)
+			}
+		})
+	}
+}
+
+// countingLimiter counts the calls of Wait and fails them if err is set.
+type countingLimiter struct {
+	calls atomic.Int64
+	err   error
+}
+
+func (l *countingLimiter) Wait(ctx context.Context) error {
+	l.calls.Add(1)
+	return l.err
+}
+
+func TestLimiter(t *testing.T) {
+	limiter := &countingLimiter{}
+	flaky, flakyRequests := flakyServer(t, 1, http.StatusServiceUnavailable, "")
+	body := testCalendar("a")
+	server, requests := calendarServer(t, &body)
+	first := &Cache{Config: Config{URL: flaky.URL}, Limiter: limiter}
+	second := &Cache{Config: Config{URL: server.URL}, Limiter: limiter}
+	mustGet(t, first)
+	mustGet(t, second)
+	if got, want := limiter.calls.Load(), flakyRequests.Load()+requests.Load(); got != want || got != 3 {
+		t.Fatalf("got %d calls of Wait, want one per request (%d)", got, want)
+	}
+
+	limiter.err = context.DeadlineExceeded
+	if _, _, err := second.ForceRefresh(time.UTC); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want the limiter error", err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Fatalf("got %d requests, the limiter error has not prevented the request", got)
+	}
+}
+
+func TestMirrors(t *testing.T) {
+	primary, status := statusServer(t)
+	body := testCalendar("a", "b")
+	secondary, secondaryRequests := calendarServer(t, &body)
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	status.Store(http.StatusBadGateway)
+	cache := &Cache{Config: Config{URL: dead.URL, URLs: []string{primary.URL, secondary.URL}}, Retries: -1}
+	if events := mustGet(t, cache); len(events) != 2 {
+		t.Fatalf("got %v, want the events of the secondary", events)
+	}
+
+	// the secondary is requested first now
+	status.Store(http.StatusOK)
+	if _, _, err := cache.ForceRefresh(time.UTC); err != nil {
+		t.Fatal(err)
+	}
+	if got := secondaryRequests.Load(); got != 2 {
+		t.Fatalf("got %d requests of the secondary, want 2", got)
+	}
+
+	// no failover on 4xx
+	status.Store(http.StatusNotFound)
+	cache = &Cache{Config: Config{URL: primary.URL, URLs: []string{secondary.URL}}, Retries: -1}
+	if _, _, err := cache.Get(time.UTC); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got %v, want the 404 of the primary", err)
+	}
+	if got := secondaryRequests.Load(); got != 2 {
+		t.Fatalf("the secondary has been requested after a 404")
+	}
+}
+
+func TestHeadETag(t *testing.T) {
+	etags := &etagServer{version: "a"}
+	var mu sync.Mutex
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		methods = append(methods, r.Method)
+		mu.Unlock()
+		etags.ServeHTTP(w, r) // no Last-Modified header
+	}))
+	defer server.Close()
+	requests := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		s := strings.Join(methods, " ")
+		methods = nil
+		return s
+	}
+	cache := &Cache{Config: Config{URL: server.URL, HeadRequest: true}}
+
+	mustGet(t, cache)
+	if got := requests(); got != "HEAD GET" {
+		t.Fatalf("got %s on the first refresh", got)
+	}
+	if events, _, err := cache.ForceRefresh(time.UTC); err != nil || len(events) != 1 || events[0].UID != "a" {
+		t.Fatalf("got %v, %v", events, err)
+	}
+	if got := requests(); got != "HEAD" {
+		t.Fatalf("got %s with unchanged etag, want HEAD only", got)
+	}
+	etags.set("b")
+	if events, _, err := cache.ForceRefresh(time.UTC); err != nil || len(events) != 1 || events[0].UID != "b" {
+		t.Fatalf("got %v, %v after the change", events, err)
+	}
+	if got := requests(); got != "HEAD GET" {
+		t.Fatalf("got %s with changed etag", got)
+	}
+}
+
+// closingServer closes the connection without response for the first failures requests.
+func closingServer(t *testing.T, failures int) (*httptest.Server, *atomic.Int64) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= int64(failures) {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
+		io.WriteString(w, testCalendar("a"))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestStaleConnection(t *testing.T) {
+	server, requests := closingServer(t, 1)
+	cache := &Cache{Config: Config{URL: server.URL}, Retries: -1}
+	if events := mustGet(t, cache); len(events) != 1 {
+		t.Fatalf("got %v", events)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Fatalf("got %d requests, want one retry", got)
+	}
+
+	server, requests = closingServer(t, 3)
+	cache = &Cache{Config: Config{URL: server.URL}, Retries: -1}
+	if _, _, err := cache.Get(time.UTC); err == nil {
+		t.Fatal("got no error")
+	}
+	if got := requests.Load(); got != 2 {
+		t.Fatalf("got %d requests, want only one retry", got)
+	}
+}
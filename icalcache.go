@@ -1,34 +1,76 @@
 package icalcache
 
 import (
-	"crypto/tls"
+	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"hash/fnv"
 	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
 	"net/http"
 	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/emersion/go-ical"
+	"golang.org/x/oauth2"
 )
 
-var client = &http.Client{
-	Timeout: 5 * time.Second,
-	Transport: &http.Transport{
-		TLSClientConfig: &tls.Config{
-			// InsecureSkipVerify:
-		},
-	},
+type Config struct {
+	URL              string            `json:"url"`
+	URLs             []string          `json:"urls"`        // optional, mirrors which are tried after URL, in order
+	Username         string            `json:"username"`    // optional
+	Password         string            `json:"password"`    // optional
+	AuthScheme       string            `json:"auth-scheme"` // optional, AuthBasic (default) or AuthDigest
+	Token            string            `json:"token"`       // optional, bearer token, mutually exclusive with Username and Password
+	SkipTLSVerify    bool              `json:"skip-tls-verify"`
+	ProxyURL         string            `json:"proxy-url"`          // optional, http, https or socks5 proxy for this calendar
+	HostOverride     map[string]string `json:"host-override"`      // optional, maps host names to "ip" or "ip:port", like curl --resolve
+	UnixSocket       string            `json:"unix-socket"`        // optional, path of a unix socket which all connections are made to, while the URL still determines Host header and path
+	CAFile           string            `json:"ca-file"`            // optional, PEM file with CA certificates which replace the system pool
+	CAPEM            string            `json:"ca-pem"`             // optional, like CAFile but inline
+	ClientCertFile   string            `json:"client-cert-file"`   // optional, PEM file with a TLS client certificate
+	ClientKeyFile    string            `json:"client-key-file"`    // optional, PEM file with the key of the TLS client certificate
+	ClientCertPEM    string            `json:"client-cert-pem"`    // optional, like ClientCertFile but inline
+	ClientKeyPEM     string            `json:"client-key-pem"`     // optional, like ClientKeyFile but inline
+	MinTLSVersion    string            `json:"min-tls-version"`    // optional, like "1.2", default is the Go default
+	NoRedirects      bool              `json:"no-redirects"`       // optional, fail instead of following redirects
+	Cookies          bool              `json:"cookies"`            // optional, keep cookies in a jar of this cache, for appliances which issue session cookies
+	SkipContentCheck bool              `json:"skip-content-check"` // optional, don't return a NotICalendarError if the response does not start with BEGIN:VCALENDAR
+	OAuth2           OAuth2Config      `json:"oauth2"`             // optional
+	Headers          map[string]string `json:"headers"`            // optional, custom request headers like X-Api-Key
+	UserAgent        string            `json:"user-agent"`         // optional, default is DefaultUserAgent
+	HeadRequest      bool              `json:"head-request"`       // optional, check Last-Modified with a HEAD request instead of a conditional GET, for servers which misbehave with conditional requests
+	Protocol         string            `json:"protocol"`           // optional, ProtocolHTTP (default) or ProtocolCalDAV, which queries URL as a CalDAV collection
+	CalDAVSync       bool              `json:"caldav-sync"`        // optional, with ProtocolCalDAV, download only changed events with a WebDAV sync-collection report, ignoring the time range
 }
 
-type Config struct {
-	URL           string `json:"url"`
-	Username      string `json:"username"` // optional
-	Password      string `json:"password"` // optional
-	SkipTLSVerify bool   `json:"skip-tls-verify"`
+// Authentication schemes for Username and Password
+const (
+	AuthBasic  = "basic"
+	AuthDigest = "digest"
+)
+
+// Protocols of the upstream URL
+const (
+	ProtocolHTTP   = "http"
+	ProtocolCalDAV = "caldav"
+)
+
+// urls returns URL and URLs.
+func (config Config) urls() []string {
+	var urls []string
+	if config.URL != "" {
+		urls = append(urls, config.URL)
+	}
+	return append(urls, config.URLs...)
 }
 
 func LoadConfig(jsonfile string) (Config, error) {
@@ -40,184 +82,983 @@ func LoadConfig(jsonfile string) (Config, error) {
 	if err := json.Unmarshal(filecontent, &config); err != nil {
 		return Config{}, fmt.Errorf("error decoding ical config: %v", err)
 	}
+	config, err = config.splitUserinfo()
+	if err != nil {
+		return Config{}, fmt.Errorf("error validating ical config: %v", err)
+	}
+	if err := config.validate(); err != nil {
+		return Config{}, fmt.Errorf("error validating ical config: %v", err)
+	}
 	return config, nil
 }
 
+func (config Config) validate() error {
+	if config.Token != "" && (config.Username != "" || config.Password != "") {
+		return errors.New("token and username/password are mutually exclusive")
+	}
+	if config.OAuth2.TokenURL != "" && (config.Token != "" || config.Username != "" || config.Password != "") {
+		return errors.New("oauth2 and token or username/password are mutually exclusive")
+	}
+	if config.ProxyURL != "" {
+		if _, err := parseProxyURL(config.ProxyURL); err != nil {
+			return err
+		}
+	}
+	if config.CAFile != "" || config.CAPEM != "" {
+		if _, err := config.transportConfig().certPool(); err != nil {
+			return err
+		}
+	}
+	if tc := config.transportConfig(); tc.hasClientCert() {
+		if _, err := tc.clientCert(); err != nil {
+			return err
+		}
+	}
+	if _, err := parseTLSVersion(config.MinTLSVersion); err != nil {
+		return err
+	}
+	switch config.AuthScheme {
+	case "", AuthBasic, AuthDigest:
+	default:
+		return fmt.Errorf("unknown auth scheme: %s", config.AuthScheme)
+	}
+	switch config.Protocol {
+	case "", ProtocolHTTP, ProtocolCalDAV:
+	default:
+		return fmt.Errorf("unknown protocol: %s", config.Protocol)
+	}
+	return nil
+}
+
+// A Fetcher gets the raw calendar data. If notModified is true, the cached events are kept and body is nil. Else the caller closes body. If lastModified is zero, a hash is used for change detection, see HashRaw.
+type Fetcher interface {
+	Fetch(ctx context.Context) (body io.ReadCloser, lastModified time.Time, notModified bool, err error)
+}
+
+// FetcherFunc is an adapter to use an ordinary function as a Fetcher.
+type FetcherFunc func(ctx context.Context) (io.ReadCloser, time.Time, bool, error)
+
+func (f FetcherFunc) Fetch(ctx context.Context) (io.ReadCloser, time.Time, bool, error) {
+	return f(ctx)
+}
+
+// A Limiter bounds the rate of upstream requests. It can be shared among caches. Wait blocks until a request is allowed, or returns an error if the context is done or its deadline would be exceeded. It is implemented by *rate.Limiter from golang.org/x/time/rate.
+type Limiter interface {
+	Wait(ctx context.Context) error
+}
+
+// EventError is returned if a property of an event can't be parsed.
+type EventError struct {
+	UID string // empty if unknown
+	Err error
+}
+
+func (err EventError) Error() string {
+	return fmt.Sprintf("event %q: %v", err.UID, err.Err)
+}
+
+func (err EventError) Unwrap() error {
+	return err.Err
+}
+
 type Event struct {
-	AllDay        bool
-	Start         time.Time
-	End           time.Time
-	RecurrenceSet string
-	UID           string
-	URL           string
-	Summary       string
-	Description   string
+	AllDay         bool
+	Start          time.Time
+	End            time.Time
+	RecurrenceSet  string
+	UID            string
+	URL            string
+	Summary        string
+	Description    string
+	Location       string
+	Organizer      Organizer // zero if the event has no ORGANIZER
+	Attendees      []Attendee
+	Status         string // StatusConfirmed, StatusTentative, StatusCancelled or empty
+	Categories     []string
+	Geo            *Geo // nil if the event has no valid GEO property or geo URI in X-APPLE-STRUCTURED-LOCATION
+	Alarms         []Alarm
+	Transparent    bool        // from TRANSP or X-MICROSOFT-CDO-BUSYSTATUS, true if the event does not block time
+	Created        time.Time   // zero if absent
+	LastModified   time.Time   // of the event, unlike the lastModified value returned by Get, zero if absent
+	Sequence       int         // revision of the event
+	ExceptionDates []time.Time // from all EXDATE properties, also part of RecurrenceSet
 }
 
+// Cache is a caching client for one calendar. Its exported fields must be set before the first call of a method and not be changed afterwards, because neither are they validated again nor are writes synchronized with running refreshes. Use SetConfig to replace the config.
 type Cache struct {
 	Config
-	Interval time.Duration // default is two minutes
+	Interval         time.Duration     // default is DefaultInterval, at least MinInterval, or AlwaysCheck, must exceed HeadTimeout (if Config.HeadRequest is enabled) plus GetTimeout
+	MinInterval      time.Duration     // default is DefaultMinInterval, smaller intervals are raised to it
+	AllowFastPolling bool              // allow any positive Interval, for upstreams which the caller controls
+	ErrorInterval    time.Duration     // default is DefaultErrorInterval, used instead of Interval after a failed refresh, at most Interval
+	ErrorBackoff     bool              // double the ErrorInterval after each consecutive failed refresh, up to Interval
+	BreakerThreshold int               // default is DefaultBreakerThreshold, negative disables the circuit breaker: after this many consecutive failed refreshes, upstream is checked only every BreakerCooldown, while the cached events are returned immediately
+	BreakerCooldown  time.Duration     // default is DefaultBreakerCooldown, ForceRefresh ignores it
+	Jitter           float64           // optional, like 0.1 for a random deviation of up to ±10% of the wait until the next check, so caches which have been created together don't refresh in lockstep
+	Rand             func() float64    // optional, returns random numbers in [0, 1) for Jitter, default is rand.Float64 from math/rand/v2
+	Timeout          time.Duration     // default is DefaultTimeout, default for HeadTimeout and GetTimeout
+	HeadTimeout      time.Duration     // applies to the HEAD request, see Config.HeadRequest
+	GetTimeout       time.Duration     // applies to the GET request including reading the body
+	Retries          int               // default is DefaultRetries, negative disables retrying transient errors of the GET request
+	MaxBodyBytes     int64             // default is DefaultMaxBodyBytes
+	MaxEvents        int               // optional, a refresh fails with a TooManyEventsError if upstream has more events
+	TruncateEvents   bool              // with MaxEvents, keep the first MaxEvents events instead of failing, see Stats.Truncated
+	PastHorizon      time.Duration     // optional, drop events which have ended before now minus PastHorizon when upstream data is parsed, MaxEvents counts only the kept events
+	FutureHorizon    time.Duration     // optional, drop events which start after now plus FutureHorizon
+	MaxFreshness     time.Duration     // default is DefaultMaxFreshness, caps the freshness lifetime which upstream advertises with Cache-Control max-age or Expires
+	Client           *http.Client      // optional, SkipTLSVerify has no effect if set
+	Limiter          Limiter           // optional, applies to every HTTP request
+	OnRequest        func(RequestInfo) // optional, called after each upstream HTTP request while the cache is locked, so it must not call methods of the cache
+
+	Resolver *net.Resolver // optional, used for name resolution instead of the system resolver, has no effect if Client is set
+	Pool     PoolConfig    // optional, has no effect if Client is set, see also NewSharedTransport
+
+	// BlockPrivateAddresses refuses connections to loopback, link-local, private and unique-local addresses, and file URLs. Use it if the URL is supplied by untrusted users. It has no effect if Client is set. It can't be combined with Config.ProxyURL or Config.UnixSocket, because the upstream address is not dialed then.
+	BlockPrivateAddresses bool
+	Fetcher               Fetcher // optional, replaces the built-in HTTP and file fetching, Config is ignored then
+
+	// Logger receives debug records about refresh decisions and warn records about problems which are not returned as errors, like invalid events which have been skipped. Use Logger.With to tell caches apart.
+	Logger *slog.Logger
+
+	// Tracer creates spans for Get calls and refreshes, see the icalotel package.
+	Tracer Tracer
+
+	// OnIntervalRaised is called once if Interval is below MinInterval and has been raised to it. It is called while the cache is locked, so it must not call methods of the cache.
+	OnIntervalRaised func(interval, minInterval time.Duration)
+
+	// OnChange is called after a refresh has found new upstream data, as determined by its hash or modification timestamp, and after the first successful refresh. It is called outside the lock, so it can call methods of the cache, and it may run concurrently with them. Calls are made one at a time and in the order of the refreshes, so old is the new of the previous call: if a refresh finds new data while OnChange is running, the running call's goroutine makes the next call after it returns, otherwise the Get call which has refreshed is blocked. DiffEvents compares old and new.
+	OnChange func(old, new []Event)
+
+	// MaxStale makes Get return a StaleError instead of the cached events if refreshing fails and the last successful refresh is older. By default, cached events are returned regardless of their age.
+	MaxStale time.Duration
+
+	// KeepRaw keeps the body of the last successful download in memory, see Raw.
+	KeepRaw bool
+
+	// CacheDir is a directory where the body of the last download and its validators are stored, so after a restart the stored events are used and upstream is checked with a conditional request. Files which can't be read or parsed are ignored and overwritten.
+	CacheDir string
+
+	// Store persists the events and validators, like CacheDir, but it is written only if the events have changed. It is read on the first check, unless CacheDir has been used.
+	Store Store
+
+	// Static makes the cache return the events which have been set with SetEvents or LoadSnapshot, without ever contacting upstream.
+	Static bool
+
+	// SkipCancelled drops events with STATUS:CANCELLED when parsing. Tentative events are kept, see Event.Status.
+	SkipCancelled bool
+
+	// HashRaw detects changes by a hash of the body, like the one which skips parsing, if upstream sends no modification timestamp. By default, a hash of the parsed events is used, so changes which don't affect them, like a new DTSTAMP or PRODID in every response, are ignored.
+	HashRaw bool
+
+	// SkipInvalidEvents skips events whose properties can't be parsed, instead of failing the refresh. The errors are returned by Warnings, along with invalid optional properties which have been ignored.
+	SkipInvalidEvents bool
+
+	// AsyncRefresh makes Get return the cached events immediately and check upstream in the background, so the new events are returned by a subsequent call. Only the first call waits for upstream.
+	AsyncRefresh bool
+
+	// By default, while one Get call is checking upstream, concurrent calls return the cached events without waiting. WaitForRefresh makes them wait for the result instead, for callers who rely on getting fresh data when upstream has changed.
+	WaitForRefresh bool
+
+	CalDAVPast   time.Duration // default is DefaultCalDAVPast, start of the time range of CalDAV queries before now
+	CalDAVFuture time.Duration // default is DefaultCalDAVFuture, end of the time range of CalDAV queries after now
 
 	lock         sync.Mutex
 	events       []Event
 	lastChecked  time.Time
-	lastHashSum  string
+	lastETag     string // ETag of the last successful GET
+	lastHashSum  string // of the last body, keeps the cached events if it is unchanged
 	lastModified int64
+	lastURL      string  // URLs which lastETag and lastHTTPLastModified belong to
+	lastLocation string  // defaultLocation of the last parse
+	warnings     []error // events which have been skipped and properties which have been ignored in the last parse
+	truncated    bool    // events have been dropped in the last parse because of MaxEvents
+	raw          []byte  // body of the last parse, if KeepRaw is set
+	restored     bool    // CacheDir and Store have been read
+
+	lastHTTPLastModified string        // Last-Modified header of the last successful GET, sent as If-Modified-Since
+	headUnsupported      bool          // upstream answered a HEAD request with 405 or 501
+	mirror               int           // index of the URL which succeeded last
+	freshness            time.Duration // advertised by upstream in the last response
+	retryAfter           time.Time     // from the last 429 or 503 response
+	lastCTag             string        // CTag of the CalDAV collection at the last successful query
+
+	syncURL             string            // CalDAV collection which syncToken belongs to
+	syncToken           string            // from the last sync-collection report
+	syncResources       map[string]string // calendar data by href
+	lastSyncIncremental bool
+
+	transfer transferCounters
+	metrics  metricsCounters
+
+	stopLock   sync.Mutex  // not the lock, so Stop doesn't wait for a running fetch before canceling it
+	background *background // goroutine of Start, guarded by stopLock
+
+	current atomic.Pointer[published] // result of the last refresh, read by Get without locking
+
+	loaded      bool             // a refresh has succeeded since the cache was created or invalidated
+	lastSuccess time.Time        // end of the last successful refresh
+	failures    int              // consecutive failed refreshes
+	clock       func() time.Time // see SetClock
+	jitter      float64          // deviation of the wait after lastChecked, drawn when checking upstream
+	location    *time.Location   // see WithLocation
+
+	intervalRaised bool // OnIntervalRaised has been called and Logger has been notified
+
+	lastContentHash string // of the last parsed events, or of the body if HashRaw is set
+
+	generation       atomic.Uint64 // see Generation, written under the lock
+	generationEvents []Event       // events of the current generation, kept by invalidate
+	generationHash   string        // eventsHash of generationEvents
+	previousEvents   []Event       // events of the previous generation, see LastDiff
+
+	lastError atomic.Pointer[failure] // of the last refresh, nil if it succeeded
+	changed   *change                 // pending OnChange call
+	changes   uint64                  // counts changes, written under the lock
+
+	watchLock  sync.Mutex
+	watchers   []*watcher
+	pending    []change // changes to be delivered, in order
+	delivering bool     // a goroutine is delivering the pending changes
+
+	client       *http.Client // created for clientConfig, if the shared default clients don't fit
+	clientConfig transportConfig
+
+	digest *digestAuth // last digest challenge
+
+	token       *oauth2.Token
+	tokenConfig OAuth2Config // config which token was obtained with
 }
 
-// Get returns all events. The defaultLocation parameter is used if the ical data contains no TZID location.
+// DefaultErrorInterval is used if Cache.ErrorInterval is zero.
+const DefaultErrorInterval = 30 * time.Second
+
+// errorInterval returns the wait after cache.failures consecutive failed refreshes, at most the interval. The caller must hold the lock.
+func (cache *Cache) errorInterval() time.Duration {
+	wait := cache.ErrorInterval
+	if wait <= 0 {
+		wait = DefaultErrorInterval
+	}
+	if cache.ErrorBackoff {
+		for i := 1; i < cache.failures && wait < cache.interval(); i++ {
+			wait *= 2
+		}
+	}
+	return min(wait, cache.interval())
+}
+
+// SetClock replaces time.Now for scheduling and timestamps, for example in tests. It must be called before the cache is used.
+func (cache *Cache) SetClock(now func() time.Time) {
+	cache.clock = now
+}
+
+func (cache *Cache) now() time.Time {
+	if cache.clock != nil {
+		return cache.clock()
+	}
+	return time.Now()
+}
+
+// DefaultInterval is used if Cache.Interval is zero.
+const DefaultInterval = 2 * time.Minute
+
+// DefaultMinInterval is used if Cache.MinInterval is zero.
+const DefaultMinInterval = 30 * time.Second
+
+// AlwaysCheck, or any negative Cache.Interval, makes every Get check upstream, regardless of the freshness which upstream advertises, for example when upstream notifies about changes. Not modified responses and unchanged hashes still skip the download or parsing. While one Get call is checking upstream, concurrent calls return the cached events, unless WaitForRefresh is set. Retry-After is respected, and Start refreshes every DefaultInterval.
+const AlwaysCheck time.Duration = -1
+
+// interval does not modify cache.Interval, because concurrent Get calls would race. It returns zero for AlwaysCheck. The caller must hold the lock.
+func (cache *Cache) interval() time.Duration {
+	switch {
+	case cache.Interval < 0:
+		return 0
+	case cache.Interval == 0:
+		return DefaultInterval
+	}
+	minInterval := cache.MinInterval
+	if minInterval <= 0 {
+		minInterval = DefaultMinInterval
+	}
+	if cache.Interval < minInterval && !cache.AllowFastPolling {
+		if !cache.intervalRaised {
+			cache.intervalRaised = true
+			if cache.Logger != nil {
+				cache.Logger.Warn("raising interval", "interval", cache.Interval, "min-interval", minInterval)
+			}
+			if cache.OnIntervalRaised != nil {
+				cache.OnIntervalRaised(cache.Interval, minInterval)
+			}
+		}
+		return minInterval
+	}
+	return cache.Interval
+}
+
+// Get returns all events. The defaultLocation parameter is used if the ical data contains no TZID location. If it is nil, the location of WithLocation or UTC is used. The returned slice is shared among callers and never modified by the cache, each refresh builds a new one, so callers must not modify it.
+//
+// By default, Get sends a single conditional GET request and no HEAD request. If upstream answers with neither 304 Not Modified nor a Last-Modified header, a hash of the parsed events is used for change detection, see HashRaw.
 func (cache *Cache) Get(defaultLocation *time.Location) ([]Event, int64, error) {
-	// check cache configuration
-	if cache.URL == "" {
-		return nil, 0, nil
+	return cache.GetContext(context.Background(), defaultLocation)
+}
+
+// GetContext is like Get. If ctx is done before the upstream request completes, it returns the cached events and ctx.Err().
+func (cache *Cache) GetContext(ctx context.Context, defaultLocation *time.Location) ([]Event, int64, error) {
+	defaultLocation = cache.defaultLocation(defaultLocation)
+	if cache.Tracer != nil {
+		ctx, span := cache.Tracer.Start(ctx, "icalcache.Get")
+		return getSpan{span}.end(cache.checkStale(cache.getContext(ctx, defaultLocation)))
+	}
+	return cache.checkStale(cache.getContext(ctx, defaultLocation))
+}
+
+func (cache *Cache) getContext(ctx context.Context, defaultLocation *time.Location) ([]Event, int64, error) {
+	// read the result of the last refresh without locking
+	if current := cache.current.Load(); current != nil && !cache.WaitForRefresh {
+		if cache.Static || cache.now().Before(current.nextCheck) {
+			cache.hit()
+			return current.events, current.lastModified, nil
+		}
+		if cache.AsyncRefresh {
+			cache.revalidate(defaultLocation)
+			cache.hit()
+			return current.events, current.lastModified, nil
+		}
+		if !cache.lock.TryLock() { // another call is refreshing
+			cache.hit()
+			return current.events, current.lastModified, nil
+		}
+		defer cache.unlock()
+		if configured, err := cache.checkConfig(); !configured || err != nil {
+			return cache.events, cache.lastModified, err
+		}
+		return cache.get(ctx, defaultLocation)
+	}
+
+	// The first call and, with WaitForRefresh, all calls wait for a running refresh.
+	cache.lock.Lock()
+	defer cache.unlock()
+	if configured, err := cache.checkConfig(); !configured || err != nil {
+		return cache.events, cache.lastModified, err
 	}
-	if cache.Interval < 30*time.Second { // see also http client timeout
-		cache.Interval = 2 * time.Minute
+	return cache.get(ctx, defaultLocation)
+}
+
+// ForceRefresh is like Get, but checks upstream immediately, regardless of Interval, the advertised freshness and Retry-After. Not modified responses and unchanged hashes still skip parsing.
+func (cache *Cache) ForceRefresh(defaultLocation *time.Location) ([]Event, int64, error) {
+	return cache.ForceRefreshContext(context.Background(), defaultLocation)
+}
+
+// ForceRefreshContext is like ForceRefresh with a context, see GetContext.
+func (cache *Cache) ForceRefreshContext(ctx context.Context, defaultLocation *time.Location) ([]Event, int64, error) {
+	defaultLocation = cache.defaultLocation(defaultLocation)
+	if cache.Tracer != nil {
+		ctx, span := cache.Tracer.Start(ctx, "icalcache.ForceRefresh")
+		return getSpan{span}.end(cache.checkStale(cache.forceRefresh(ctx, defaultLocation)))
 	}
+	return cache.checkStale(cache.forceRefresh(ctx, defaultLocation))
+}
 
-	// If a function call fetches from upstream, subsequent calls have to wait. (Else they would always get stale data in scenarios with frequent upstream changes and few calls.)
+func (cache *Cache) forceRefresh(ctx context.Context, defaultLocation *time.Location) ([]Event, int64, error) {
+	cache.lock.Lock()
+	defer cache.unlock()
+	if configured, err := cache.checkConfig(); !configured || err != nil {
+		return cache.events, cache.lastModified, err
+	}
+	return cache.check(ctx, defaultLocation)
+}
+
+// GetOptions are the options of GetWithOptions.
+type GetOptions struct {
+	MaxAge time.Duration // if positive, check upstream if the last check is older, even if Interval has not passed yet, but not before Retry-After, the error interval or the breaker cooldown; if zero, return the cached events without checking upstream, unless nothing is cached yet
+}
+
+// GetWithOptions is like GetContext, but lets the caller decide how old the events may be. Unlike GetContext, it waits for a running refresh if the cached events are too old. Then it checks upstream only if the refresh which it has waited for is too old as well, so concurrent callers don't check upstream repeatedly.
+func (cache *Cache) GetWithOptions(ctx context.Context, defaultLocation *time.Location, options GetOptions) ([]Event, int64, error) {
+	defaultLocation = cache.defaultLocation(defaultLocation)
+	if cache.Tracer != nil {
+		ctx, span := cache.Tracer.Start(ctx, "icalcache.Get")
+		return getSpan{span}.end(cache.checkStale(cache.getWithOptions(ctx, defaultLocation, options)))
+	}
+	return cache.checkStale(cache.getWithOptions(ctx, defaultLocation, options))
+}
+
+func (cache *Cache) getWithOptions(ctx context.Context, defaultLocation *time.Location, options GetOptions) ([]Event, int64, error) {
+	if current := cache.current.Load(); current != nil {
+		if options.MaxAge <= 0 || cache.Static || cache.fresh(current.nextCheck, current.lastChecked, current.backoff, options.MaxAge) {
+			cache.hit()
+			return current.events, current.lastModified, cache.pendingError(current.backoff, current.lastSuccess)
+		}
+	} else if options.MaxAge <= 0 {
+		return cache.getContext(ctx, defaultLocation)
+	}
+
+	cache.lock.Lock()
+	defer cache.unlock()
+	if configured, err := cache.checkConfig(); !configured || err != nil {
+		return cache.events, cache.lastModified, err
+	}
+	if cache.current.Load() != nil && cache.fresh(cache.nextCheck(), cache.lastChecked, cache.backoff(), options.MaxAge) {
+		cache.hit()
+		return cache.events, cache.lastModified, cache.pendingError(cache.backoff(), cache.lastSuccess)
+	}
+	return cache.check(ctx, defaultLocation)
+}
+
+// fresh reports whether neither nextCheck nor lastChecked plus maxAge has passed. While the cache backs off, maxAge is ignored.
+func (cache *Cache) fresh(nextCheck, lastChecked time.Time, backoff bool, maxAge time.Duration) bool {
+	now := cache.now()
+	return now.Before(nextCheck) && (backoff || now.Before(lastChecked.Add(maxAge)))
+}
+
+// pendingError returns the error of the last refresh while the cache backs off and no refresh has succeeded yet, so there are no cached events to return instead.
+func (cache *Cache) pendingError(backoff bool, lastSuccess time.Time) error {
+	if f := cache.lastError.Load(); f != nil && backoff && lastSuccess.IsZero() {
+		return f.err
+	}
+	return nil
+}
+
+// Invalidate drops the cached events and all change detection state, so the next Get fetches and parses the calendar again.
+func (cache *Cache) Invalidate() {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	cache.invalidate()
+}
+
+// SetConfig replaces the config and invalidates the cache, see Invalidate. Use it instead of assigning Config while the cache is in use.
+func (cache *Cache) SetConfig(config Config) {
 	cache.lock.Lock()
 	defer cache.lock.Unlock()
+	cache.Config = config
+	cache.invalidate()
+	cache.restored = false
+}
 
+// invalidate resets the state which depends on upstream. Clients and OAuth2 tokens are kept, they are replaced if the config has changed. The caller must hold the lock.
+func (cache *Cache) invalidate() {
+	cache.events = nil
+	cache.lastChecked = time.Time{}
+	cache.lastHashSum = ""
+	cache.lastContentHash = ""
+	cache.lastModified = 0
+	cache.warnings = nil
+	cache.truncated = false
+	cache.raw = nil
+	cache.lastURL = ""
+	cache.resetValidators()
+	cache.headUnsupported = false
+	cache.mirror = 0
+	cache.freshness = 0
+	cache.retryAfter = time.Time{}
+	cache.syncURL = ""
+	cache.lastSyncIncremental = false
+	cache.digest = nil
+	cache.current.Store(nil)
+	cache.loaded = false
+	cache.lastSuccess = time.Time{}
+	cache.failures = 0
+	cache.lastError.Store(nil)
+}
+
+// checkConfig returns false if no upstream is configured, and an error if the configuration is invalid. The caller must hold the lock.
+func (cache *Cache) checkConfig() (bool, error) {
+	if len(cache.urls()) == 0 && cache.Fetcher == nil {
+		return false, nil
+	}
+	if cache.BlockPrivateAddresses && cache.Client == nil && (cache.ProxyURL != "" || cache.UnixSocket != "") {
+		return true, errors.New("blocking private addresses is not supported with a proxy or unix socket")
+	}
+	if cache.Interval >= 0 && cache.refreshTimeout() >= cache.interval() {
+		return true, fmt.Errorf("interval %v must exceed timeout %v", cache.interval(), cache.refreshTimeout())
+	}
+	return true, nil
+}
+
+// SetEvents replaces the cached events, for example in tests or with a fixture calendar. Get does not check upstream until the interval has passed, or never if Static is set. The slice must not be modified afterwards.
+func (cache *Cache) SetEvents(events []Event, lastModified time.Time) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	cache.events = events
+	cache.lastModified = 0
+	if !lastModified.IsZero() {
+		cache.lastModified = lastModified.Unix()
+	}
+	cache.lastHashSum = ""
+	cache.lastContentHash = ""
+	cache.truncated = false
+	cache.raw = nil
+	cache.lastChecked = cache.now()
+	cache.publish(true)
+}
+
+// published is the result of a refresh.
+type published struct {
+	events       []Event
+	lastModified int64
+	nextCheck    time.Time
+	lastChecked  time.Time
+	lastSuccess  time.Time
+	raw          []byte
+	backoff      bool
+	generation   uint64
+	changes      uint64 // number of changes which the state includes
+}
+
+// publish makes the current state available to readers which don't lock. Stored reports whether events have been stored, as opposed to kept by a failed refresh. The caller must hold the lock.
+func (cache *Cache) publish(stored bool) {
+	if (cache.generation.Load() == 0 && stored) || !cache.sameGeneration() {
+		cache.generation.Add(1)
+		cache.previousEvents = cache.generationEvents
+		cache.generationEvents = cache.events
+		cache.generationHash = eventsHash(cache.events)
+	}
+	cache.current.Store(&published{cache.events, cache.lastModified, cache.nextCheck(), cache.lastChecked, cache.lastSuccess, cache.raw, cache.backoff(), cache.generation.Load(), cache.changes})
+}
+
+// revalidate refreshes the cache in the background if upstream is due to be checked. If another call holds the lock, it assumes that a refresh is running.
+func (cache *Cache) revalidate(defaultLocation *time.Location) {
+	if !cache.lock.TryLock() {
+		return
+	}
+	if configured, err := cache.checkConfig(); !configured || err != nil || cache.now().Before(cache.nextCheck()) {
+		cache.lock.Unlock()
+		return
+	}
+	go func() {
+		defer cache.unlock()
+		cache.get(context.Background(), defaultLocation) // on error, the cached events are kept
+	}()
+}
+
+// get checks upstream if it is due. The caller must hold the lock.
+func (cache *Cache) get(ctx context.Context, defaultLocation *time.Location) ([]Event, int64, error) {
 	// skip if upstream has recently been checked
-	if time.Since(cache.lastChecked) < cache.Interval {
+	if cache.now().Before(cache.nextCheck()) {
+		cache.hit()
 		return cache.events, cache.lastModified, nil
 	}
-	cache.lastChecked = time.Now()
+	return cache.check(ctx, defaultLocation)
+}
 
-	// HTTP HEAD upstream
-	req, err := http.NewRequest(http.MethodHead, cache.URL, nil)
-	if err != nil {
-		return cache.events, cache.lastModified, fmt.Errorf("making upstream header request: %w", err)
+type change struct {
+	old, new     []Event
+	lastModified int64
+	generation   uint64
+	seq          uint64 // value of changes
+}
+
+// unlock releases the lock and calls OnChange and notifies watchers if a refresh has changed the events meanwhile.
+func (cache *Cache) unlock() {
+	changed := cache.changed
+	cache.changed = nil
+	if changed != nil {
+		cache.watchLock.Lock()
+		cache.pending = append(cache.pending, *changed) // under the lock, so the changes are queued in order
+		cache.watchLock.Unlock()
 	}
-	if cache.Config.Username != "" {
-		req.SetBasicAuth(cache.Config.Username, cache.Config.Password)
+	cache.lock.Unlock()
+	if changed != nil {
+		cache.deliver()
 	}
-	if t, ok := client.Transport.(*http.Transport); ok {
-		t.TLSClientConfig.InsecureSkipVerify = cache.SkipTLSVerify
+}
+
+// check refreshes the cache from upstream. The caller must hold the lock and release it with unlock.
+func (cache *Cache) check(ctx context.Context, defaultLocation *time.Location) ([]Event, int64, error) {
+	if cache.Static {
+		return cache.events, cache.lastModified, nil
 	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return cache.events, cache.lastModified, fmt.Errorf("getting upstream headers: %w", err)
+	cache.lastChecked = cache.now()
+	if !cache.restored {
+		cache.restored = true
+		if cache.restore(defaultLocation) {
+			cache.publish(true) // serve the stored events while upstream is checked
+		}
+	}
+	oldEvents, oldModified, oldContentHash := cache.events, cache.lastModified, cache.lastContentHash
+	cache.jitter = 0
+	if cache.Jitter > 0 {
+		random := rand.Float64
+		if cache.Rand != nil {
+			random = cache.Rand
+		}
+		cache.jitter = min(cache.Jitter, 0.9) * (2*random() - 1) // keep the wait positive
 	}
 
-	// skip if upstream has a Last-Modified header whose value is older
-	var httpLastModifiedWasAvailable = false
-	if httpLastModified, err := time.Parse("Mon, 02 Jan 2006 15:04:05 GMT", resp.Header.Get("Last-Modified")); err == nil {
-		httpLastModifiedWasAvailable = true
-		if httpLastModified.Unix() <= cache.lastModified { // http timestamp before or equal cache timestamp
-			return cache.events, cache.lastModified, nil
+	start := time.Now()
+	events, lastModified, err := cache.refresh(ctx, defaultLocation)
+	cache.transfer.lastFetchDuration.Store(int64(time.Since(start)))
+	if cache.Logger != nil {
+		cache.Logger.Debug("checked upstream", "duration", time.Since(start), "events", len(events), "error", err)
+	}
+	switch {
+	case err == nil:
+		cache.failures = 0
+		cache.lastError.Store(nil)
+		cache.lastSuccess = cache.now()
+	case ctx.Err() == nil: // don't count canceled calls
+		cache.failures++
+		cache.lastError.Store(&failure{err, cache.now()})
+		if cache.Logger != nil && cache.circuitOpen() {
+			cache.Logger.Warn("circuit breaker open", "failures", cache.failures, "cooldown", cache.breakerCooldown())
 		}
-		cache.lastModified = httpLastModified.Unix()
 	}
+	changed := err == nil && (!cache.loaded || cache.lastModified != oldModified || cache.lastContentHash != oldContentHash)
+	if changed {
+		cache.changes++
+	}
+	cache.publish(err == nil)
+	if changed {
+		cache.loaded = true
+		cache.changed = &change{oldEvents, cache.events, cache.lastModified, cache.generation.Load(), cache.changes}
+		cache.saveStore(defaultLocation)
+	}
+	if err != nil && ctx.Err() != nil {
+		return cache.events, cache.lastModified, ctx.Err()
+	}
+	return events, lastModified, err
+}
 
-	// HTTP GET upstream
-	req, err = http.NewRequest(http.MethodGet, cache.URL, nil)
-	if err != nil {
-		return cache.events, cache.lastModified, fmt.Errorf("making upstream request: %w", err)
+func (cache *Cache) fetcher() Fetcher {
+	if cache.Fetcher != nil {
+		return cache.Fetcher
+	}
+	if path, ok := filePath(cache.urls()[0]); ok {
+		if cache.BlockPrivateAddresses {
+			return FetcherFunc(func(ctx context.Context) (io.ReadCloser, time.Time, bool, error) {
+				return nil, time.Time{}, false, errors.New("file urls are blocked")
+			})
+		}
+		return FileFetcher(path)
+	}
+	if cache.Protocol == ProtocolCalDAV {
+		return FetcherFunc(cache.fetchCalDAV)
 	}
-	if cache.Config.Username != "" {
-		req.SetBasicAuth(cache.Config.Username, cache.Config.Password)
+	return FetcherFunc(cache.fetchHTTP)
+}
+
+// refresh fetches the events from upstream. The caller must hold the lock.
+func (cache *Cache) refresh(ctx context.Context, defaultLocation *time.Location) ([]Event, int64, error) {
+	// validators are only valid for the URL they were received from
+	if urls := strings.Join(cache.urls(), " "); cache.lastURL != urls {
+		cache.resetValidators()
+		cache.lastURL = urls
+		cache.headUnsupported = false
+		cache.freshness = 0
+		cache.digest = nil
+	}
+
+	fetchCtx, fetchSpan := cache.startSpan(ctx, "icalcache.fetch")
+	if urls := cache.urls(); cache.Tracer != nil && len(urls) > 0 {
+		fetchSpan.SetAttribute("server.address", hostname(urls[0]))
 	}
-	resp, err = client.Do(req)
+	body, lastModified, notModified, err := cache.fetcher().Fetch(fetchCtx)
 	if err != nil {
-		return cache.events, cache.lastModified, fmt.Errorf("getting upstream data: %w", err)
+		cache.metrics.fetchErrors.Add(1)
+		fetchSpan.End(err)
+		return cache.events, cache.lastModified, err
+	}
+	if notModified {
+		fetchSpan.SetAttribute("icalcache.not_modified", true)
+		fetchSpan.End(nil)
+		cache.transfer.notModified.Add(1)
+		if cache.Logger != nil {
+			cache.Logger.Debug("upstream not modified")
+		}
+		return cache.events, cache.lastModified, nil
+	}
+	defer body.Close()
+
+	// skip if upstream has a modification timestamp whose value is older
+	var lastModifiedWasAvailable = !lastModified.IsZero()
+	if lastModifiedWasAvailable {
+		if lastModified.Unix() <= cache.lastModified { // upstream timestamp before or equal cache timestamp
+			fetchSpan.SetAttribute("icalcache.not_modified", true)
+			fetchSpan.End(nil)
+			cache.transfer.notModified.Add(1)
+			if cache.Logger != nil {
+				cache.Logger.Debug("upstream not newer", "last-modified", lastModified)
+			}
+			return cache.events, cache.lastModified, nil
+		}
 	}
 
-	// parse response body as ical and also hash it
+	decode := func(r io.Reader) ([]Event, []error, bool, error) {
+		_, decodeSpan := cache.startSpan(ctx, "icalcache.decode")
+		events, warnings, truncated, err := cache.parseEvents(r, defaultLocation)
+		decodeSpan.SetAttribute("icalcache.events", len(events))
+		if err == io.EOF {
+			decodeSpan.End(nil)
+		} else {
+			decodeSpan.End(err)
+		}
+		return events, warnings, truncated, err
+	}
+
+	// read and hash the response body, so an unchanged body is not parsed again
 	hash := fnv.New64()
-	cal, err := ical.NewDecoder(io.TeeReader(resp.Body, hash)).Decode()
-	if err == io.EOF { // no calendars in file
-		cache.events = nil
-		return cache.events, cache.lastModified, nil
+	limited := &limitReader{r: body, max: cache.maxBodyBytes()}
+	raw, err := io.ReadAll(io.TeeReader(limited, hash))
+	cache.transfer.bytesRead.Add(limited.n)
+	cache.transfer.downloads.Add(1)
+	fetchSpan.SetAttribute("http.response.body.size", limited.n)
+	if limited.exceeded {
+		cache.metrics.fetchErrors.Add(1)
+		cache.resetValidators()
+		err := BodyTooLargeError{limited.max}
+		fetchSpan.End(err)
+		return cache.events, cache.lastModified, err
+	}
+	if limited.err != nil {
+		err = limited.err
 	}
 	if err != nil {
-		return cache.events, cache.lastModified, fmt.Errorf("decoding upstream ical data: %w", err)
+		cache.metrics.fetchErrors.Add(1)
+		cache.resetValidators()
+		err = fmt.Errorf("reading upstream data: %w", err)
+		fetchSpan.End(err)
+		return cache.events, cache.lastModified, err
+	}
+	if cache.Logger != nil {
+		cache.Logger.Debug("downloaded upstream data", "bytes", limited.n)
 	}
 
-	// update lastHashSum (which is a fallback if HTTP Last-Modified header is missing), update lastModified if the HTTP Last-Modified header was missing
+	// skip parsing if the body is unchanged
 	hashSum := base64.StdEncoding.EncodeToString(hash.Sum(nil))
-	if !httpLastModifiedWasAvailable {
-		if hashSum != cache.lastHashSum {
-			cache.lastModified = time.Now().Unix() // only if upstream did not send a Last-Modified HTTP header (else time.Now() competes with upcoming upstream Last-Modified timestamps)
+	unchanged := hashSum == cache.lastHashSum && defaultLocation.String() == cache.lastLocation
+	fetchSpan.SetAttribute("icalcache.unchanged", unchanged)
+	fetchSpan.End(nil)
+	if unchanged {
+		cache.transfer.unchanged.Add(1)
+		if cache.Logger != nil {
+			cache.Logger.Debug("upstream data unchanged, keeping cached events")
+		}
+		if cache.KeepRaw && cache.raw == nil {
+			cache.raw = raw
+		}
+		if lastModifiedWasAvailable {
+			cache.lastModified = lastModified.Unix()
 		}
+		cache.saveDiskCache(raw, hashSum) // validators might have changed
+		return cache.events, cache.lastModified, nil
 	}
-	cache.lastHashSum = hashSum
 
-	// Update events. If an error occurs, we return an empty event list because that's better than an incomplete list.
-	cache.events = cache.events[:0]
-	for _, event := range cal.Events() {
-		uid, err := event.Props.Text(ical.PropUID)
-		if err != nil {
-			return nil, 0, fmt.Errorf("getting uid: %w", err)
+	// parse response body as ical, don't touch the cached events until decoding has succeeded
+	events, warnings, truncated, err := decode(bytes.NewReader(raw))
+	if err == io.EOF { // no calendars in file, which is a change like any other
+		events, err = nil, nil
+	}
+	if err != nil {
+		// keep the previous events, because they are better than an incomplete list
+		cache.metrics.parseErrors.Add(1)
+		cache.resetValidators() // don't get stuck with "not modified" responses
+		return cache.events, cache.lastModified, err
+	}
+
+	// update lastHashSum and lastContentHash (which is a fallback if the upstream modification timestamp is missing), update lastModified if the upstream modification timestamp was missing
+	cache.metrics.parses.Add(1)
+	contentHash := cache.contentHash(events, hashSum)
+	if lastModifiedWasAvailable {
+		cache.lastModified = lastModified.Unix()
+	} else if contentHash != cache.lastContentHash {
+		cache.lastModified = cache.now().Unix() // only if upstream did not send a modification timestamp (else the current time competes with upcoming upstream timestamps)
+	}
+	cache.lastHashSum = hashSum
+	cache.lastContentHash = contentHash
+	cache.lastLocation = defaultLocation.String()
+	cache.warnings = warnings
+	cache.truncated = truncated
+	cache.raw = nil
+	if cache.Logger != nil {
+		cache.Logger.Debug("parsed upstream data", "events", len(events))
+		for _, warning := range warnings {
+			cache.Logger.Warn("invalid event data", "error", warning)
 		}
-		summary, err := event.Props.Text(ical.PropSummary)
-		if err != nil {
-			return nil, 0, fmt.Errorf("getting summary: %w", err)
+		if truncated {
+			cache.Logger.Warn("dropped events", "max-events", cache.MaxEvents)
 		}
-		description, err := event.Props.Text(ical.PropDescription)
-		if err != nil {
-			return nil, 0, fmt.Errorf("getting description: %w", err)
+	}
+	if cache.KeepRaw {
+		cache.raw = raw
+	}
+
+	cache.events = events
+	cache.saveDiskCache(raw, hashSum)
+	return cache.events, cache.lastModified, nil
+}
+
+func (cache *Cache) hit() {
+	cache.metrics.hits.Add(1)
+	if cache.Logger != nil {
+		cache.Logger.Debug("serving cached events")
+	}
+}
+
+// parseEvents decodes ical data. It reports whether events have been dropped because of MaxEvents, and it returns io.EOF if r contains no calendars. The caller must hold the lock.
+func (cache *Cache) parseEvents(r io.Reader, defaultLocation *time.Location) ([]Event, []error, bool, error) {
+	events := make([]Event, 0, len(cache.events)) // the previous count is a good capacity hint
+	var eventErr error
+	var warnings []error
+	var truncated bool
+	horizon := cache.horizon()
+	err := decodeEvents(r, func(event ical.Event) error {
+		e, eventWarnings, err := makeEvent(event, defaultLocation)
+		if err == nil && (!horizon.contains(event, e, defaultLocation) || cache.SkipCancelled && e.Status == StatusCancelled) {
+			return nil
 		}
-		url, err := event.Props.URI(ical.PropURL)
 		if err != nil {
-			return nil, 0, fmt.Errorf("getting url: %w", err)
-		}
-
-		// replace TZIDs which can't be loaded by time.LoadLocation (workaround for https://github.com/emersion/go-ical/issues/10) with target location
-		for _, propid := range []string{ical.PropDateTimeStart, ical.PropDateTimeEnd} {
-			prop := event.Props.Get(propid)
-			if prop != nil {
-				// similar to https://github.com/emersion/go-ical/blob/fc1c9d8fb2b6/ical.go#L149C6-L149C58
-				if tzid := prop.Params.Get(ical.PropTimezoneID); tzid != "" {
-					_, err := time.LoadLocation(tzid)
-					if err != nil {
-						prop.Params.Set(ical.PropTimezoneID, defaultLocation.String())
-					}
-				}
+			uid, _ := event.Props.Text(ical.PropUID)
+			err = EventError{uid, err}
+			if cache.SkipInvalidEvents {
+				warnings = append(warnings, err)
+				return nil
 			}
+			eventErr = err
+			return err
 		}
-
-		var allDay = false
-		if startProp := event.Props.Get(ical.PropDateTimeStart); startProp != nil {
-			if startProp.ValueType() == ical.ValueDate {
-				allDay = true
+		if cache.MaxEvents > 0 && len(events) >= cache.MaxEvents {
+			if cache.TruncateEvents {
+				truncated = true
+				return errStopDecoding
 			}
+			eventErr = TooManyEventsError{cache.MaxEvents}
+			return eventErr
 		}
-
-		// go-ical "use[s] the TZID location, if available"
-		start, err := event.DateTimeStart(defaultLocation)
-		if err != nil {
-			return nil, 0, fmt.Errorf("getting start time: %w", err)
-		}
-		end, err := event.DateTimeEnd(defaultLocation)
-		if err != nil {
-			return nil, 0, fmt.Errorf("getting end time: %w", err)
+		for _, warning := range eventWarnings {
+			warnings = append(warnings, EventError{e.UID, warning})
 		}
+		events = append(events, e)
+		return nil
+	})
+	switch {
+	case eventErr != nil:
+		return nil, nil, false, eventErr
+	case err == nil, err == io.EOF:
+		return events, warnings, false, err
+	case err == errStopDecoding:
+		return events, warnings, truncated, nil
+	default:
+		return nil, nil, false, fmt.Errorf("decoding upstream ical data: %w", err)
+	}
+}
+
+// makeEvent converts a decoded VEVENT. The defaultLocation is used if the event has no TZID location. Invalid optional properties are ignored and returned as warnings.
+func makeEvent(event ical.Event, defaultLocation *time.Location) (Event, []error, error) {
+	uid, err := event.Props.Text(ical.PropUID)
+	if err != nil {
+		return Event{}, nil, fmt.Errorf("getting uid: %w", err)
+	}
+	summary, err := event.Props.Text(ical.PropSummary)
+	if err != nil {
+		return Event{}, nil, fmt.Errorf("getting summary: %w", err)
+	}
+	description, err := event.Props.Text(ical.PropDescription)
+	if err != nil {
+		return Event{}, nil, fmt.Errorf("getting description: %w", err)
+	}
+	location, err := event.Props.Text(ical.PropLocation)
+	if err != nil {
+		return Event{}, nil, fmt.Errorf("getting location: %w", err)
+	}
+	status, err := event.Props.Text(ical.PropStatus)
+	if err != nil {
+		return Event{}, nil, fmt.Errorf("getting status: %w", err)
+	}
+	categories, err := categories(event)
+	if err != nil {
+		return Event{}, nil, fmt.Errorf("getting categories: %w", err)
+	}
+	var warnings []error
+	geo, err := geo(event)
+	if err != nil {
+		warnings = append(warnings, err)
+	}
+	alarms, alarmErrs := alarms(event, defaultLocation)
+	warnings = append(warnings, alarmErrs...)
+	created, err := timestamp(event, ical.PropCreated)
+	if err != nil {
+		warnings = append(warnings, err)
+	}
+	lastModified, err := timestamp(event, ical.PropLastModified)
+	if err != nil {
+		warnings = append(warnings, err)
+	}
+	sequence, err := sequence(event)
+	if err != nil {
+		warnings = append(warnings, err)
+	}
+	url, err := event.Props.URI(ical.PropURL)
+	if err != nil {
+		return Event{}, nil, fmt.Errorf("getting url: %w", err)
+	}
 
-		var recurrenceSet string
-		if rs, err := event.RecurrenceSet(defaultLocation); err != nil {
-			return nil, 0, fmt.Errorf("getting end recurrence set: %w", err)
-		} else if rs != nil {
-			recurrenceSet = rs.String()
+	// replace TZIDs which can't be loaded by time.LoadLocation (workaround for https://github.com/emersion/go-ical/issues/10) with target location
+	for _, propid := range []string{ical.PropDateTimeStart, ical.PropDateTimeEnd, ical.PropExceptionDates} {
+		for i := range event.Props[propid] {
+			prop := &event.Props[propid][i]
+			// similar to https://github.com/emersion/go-ical/blob/fc1c9d8fb2b6/ical.go#L149C6-L149C58
+			if tzid := prop.Params.Get(ical.PropTimezoneID); tzid != "" {
+				_, err := time.LoadLocation(tzid)
+				if err != nil {
+					prop.Params.Set(ical.PropTimezoneID, defaultLocation.String())
+				}
+			}
 		}
+	}
 
-		var urlString string
-		if url != nil {
-			urlString = url.String()
+	var allDay = false
+	if startProp := event.Props.Get(ical.PropDateTimeStart); startProp != nil {
+		if startProp.ValueType() == ical.ValueDate {
+			allDay = true
 		}
+	}
+
+	// go-ical "use[s] the TZID location, if available"
+	start, err := event.DateTimeStart(defaultLocation)
+	if err != nil {
+		return Event{}, nil, fmt.Errorf("getting start time: %w", err)
+	}
+	end, err := event.DateTimeEnd(defaultLocation)
+	if err != nil {
+		return Event{}, nil, fmt.Errorf("getting end time: %w", err)
+	}
 
-		cache.events = append(cache.events, Event{
-			AllDay:        allDay,
-			Start:         start,
-			End:           end,
-			RecurrenceSet: recurrenceSet,
-			UID:           uid,
-			URL:           urlString,
-			Summary:       summary,
-			Description:   description,
-		})
+	exceptionDates, err := exceptionDates(event, defaultLocation)
+	if err != nil {
+		return Event{}, nil, fmt.Errorf("getting exception dates: %w", err)
 	}
 
-	return cache.events, cache.lastModified, nil
+	var recurrenceSet string
+	if rs, err := recurrenceRuleSet(event, exceptionDates, defaultLocation); err != nil {
+		return Event{}, nil, fmt.Errorf("getting end recurrence set: %w", err)
+	} else if rs != nil {
+		recurrenceSet = rs.String()
+	}
+
+	var urlString string
+	if url != nil {
+		urlString = url.String()
+	}
+
+	return Event{
+		AllDay:         allDay,
+		Start:          start,
+		End:            end,
+		RecurrenceSet:  recurrenceSet,
+		UID:            uid,
+		URL:            urlString,
+		Summary:        summary,
+		Description:    description,
+		Location:       location,
+		Organizer:      organizer(event),
+		Attendees:      attendees(event),
+		Status:         strings.ToUpper(strings.TrimSpace(status)),
+		Categories:     categories,
+		Geo:            geo,
+		Alarms:         alarms,
+		Transparent:    transparent(event),
+		Created:        created,
+		LastModified:   lastModified,
+		Sequence:       sequence,
+		ExceptionDates: exceptionDates,
+	}, warnings, nil
 }
@@ -0,0 +1,254 @@
+package icalcache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testCalendar returns a calendar with one event per uid.
+func testCalendar(uids ...string) string {
+	var b strings.Builder
+	b.WriteString("BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//test//EN\r\n")
+	for i, uid := range uids {
+		fmt.Fprintf(&b, "BEGIN:VEVENT\r\nUID:%s\r\nDTSTAMP:20240101T000000Z\r\nDTSTART:202401%02dT100000Z\r\nDTEND:202401%02dT110000Z\r\nSUMMARY:Event %s\r\nEND:VEVENT\r\n", uid, i+1, i+1, uid)
+	}
+	b.WriteString("END:VCALENDAR\r\n")
+	return b.String()
+}
+
+// fakeClock is a clock for SetClock which only moves when advanced.
+type fakeClock struct {
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (clock *fakeClock) Now() time.Time {
+	return clock.now
+}
+
+func (clock *fakeClock) Advance(d time.Duration) {
+	clock.now = clock.now.Add(d)
+}
+
+func uids(events []Event) []string {
+	var uids []string
+	for _, event := range events {
+		uids = append(uids, event.UID)
+	}
+	return uids
+}
+
+// eventsEqual reports whether a and b contain equal events in the same order.
+func eventsEqual(a, b []Event) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !eventEqual(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func eventEqual(a, b Event) bool {
+	return changedFields(a, b) == nil
+}
+
+func mustGet(t *testing.T, cache *Cache) []Event {
+	t.Helper()
+	events, _, err := cache.Get(time.UTC)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	return events
+}
+
+// calendarServer serves body without validators and counts the requests.
+func calendarServer(t *testing.T, body *string) (*httptest.Server, *atomic.Int64) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		io.WriteString(w, *body)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestUnchangedBody(t *testing.T) {
+	for _, keepRaw := range []bool{false, true} {
+		t.Run(fmt.Sprintf("KeepRaw=%v", keepRaw), func(t *testing.T) {
+			body := testCalendar("a", "b")
+			server, _ := calendarServer(t, &body)
+			clock := newFakeClock()
+			cache := &Cache{Config: Config{URL: server.URL}, KeepRaw: keepRaw}
+			cache.SetClock(clock.Now)
+
+			first := mustGet(t, cache)
+			clock.Advance(time.Hour)
+			second := mustGet(t, cache)
+			if &first[0] != &second[0] {
+				t.Fatal("events have been replaced although the body is unchanged")
+			}
+			metrics := cache.Metrics()
+			if metrics.Parses != 1 || metrics.Unchanged != 1 {
+				t.Fatalf("got %+v", metrics)
+			}
+			if raw, _ := cache.Raw(); keepRaw != (string(raw) == body) {
+				t.Fatalf("got raw %q", raw)
+			}
+
+			body = testCalendar("a", "b", "c")
+			clock.Advance(time.Hour)
+			if third := mustGet(t, cache); len(third) != 3 {
+				t.Fatalf("got %v", uids(third))
+			}
+		})
+	}
+}
+
+func TestUnchangedBodyNotDecoded(t *testing.T) {
+	body := testCalendar("a", "b")
+	server, _ := calendarServer(t, &body)
+	clock := newFakeClock()
+	tracer := &recordingTracer{}
+	cache := &Cache{Config: Config{URL: server.URL}, Tracer: tracer}
+	cache.SetClock(clock.Now)
+
+	mustGet(t, cache)
+	clock.Advance(time.Hour)
+	mustGet(t, cache)
+	var decodes int
+	for _, name := range tracer.names() {
+		if name == "icalcache.decode" {
+			decodes++
+		}
+	}
+	if decodes != 1 {
+		t.Fatalf("the body has been decoded %d times", decodes)
+	}
+}
+
+func TestKeepRawWithoutCalendar(t *testing.T) {
+	body := "\r\n"
+	server, _ := calendarServer(t, &body)
+	cache := &Cache{Config: Config{URL: server.URL, SkipContentCheck: true}, KeepRaw: true}
+	if events := mustGet(t, cache); len(events) != 0 {
+		t.Fatalf("got %v", uids(events))
+	}
+	if raw, _ := cache.Raw(); string(raw) != body {
+		t.Fatalf("got raw %q, want %q", raw, body)
+	}
+}
+
+func TestReadError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100000")
+		io.WriteString(w, "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\n") // the connection is closed before the announced length
+	}))
+	defer server.Close()
+	cache := &Cache{Config: Config{URL: server.URL}, Retries: -1}
+	_, _, err := cache.Get(time.UTC)
+	if err == nil || !strings.Contains(err.Error(), "reading upstream data") {
+		t.Fatalf("got %v", err)
+	}
+	if metrics := cache.Metrics(); metrics.FetchErrors != 1 || metrics.ParseErrors != 0 {
+		t.Fatalf("got %+v", metrics)
+	}
+}
+
+func TestGetWithOptionsRetryAfter(t *testing.T) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	clock := newFakeClock()
+	cache := &Cache{Config: Config{URL: server.URL}}
+	cache.SetClock(clock.Now)
+
+	for i := 0; i < 3; i++ {
+		if _, _, err := cache.GetWithOptions(context.Background(), time.UTC, GetOptions{MaxAge: time.Second}); err == nil {
+			t.Fatalf("call %d: expected the error of the 429 response", i)
+		}
+		clock.Advance(2 * time.Second)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Fatalf("got %d upstream requests during Retry-After", got)
+	}
+}
+
+func TestGetWithOptionsErrorInterval(t *testing.T) {
+	body := testCalendar("a")
+	server, requests := calendarServer(t, &body)
+	clock := newFakeClock()
+	cache := &Cache{Config: Config{URL: server.URL}, ErrorInterval: time.Minute}
+	cache.SetClock(clock.Now)
+	mustGet(t, cache)
+
+	body = "not a calendar"
+	clock.Advance(time.Hour)
+	if _, _, err := cache.Get(time.UTC); err == nil {
+		t.Fatal("expected an error")
+	}
+	for i := 0; i < 3; i++ {
+		clock.Advance(2 * time.Second)
+		events, _, err := cache.GetWithOptions(context.Background(), time.UTC, GetOptions{MaxAge: time.Second})
+		if err != nil || len(events) != 1 {
+			t.Fatalf("got %v, %v, want the cached events", events, err)
+		}
+	}
+	if got := requests.Load(); got != 2 {
+		t.Fatalf("got %d upstream requests during the error interval", got)
+	}
+	clock.Advance(time.Minute)
+	cache.GetWithOptions(context.Background(), time.UTC, GetOptions{MaxAge: time.Second})
+	if got := requests.Load(); got != 3 {
+		t.Fatalf("got %d upstream requests after the error interval", got)
+	}
+}
+
+func TestSetEvents(t *testing.T) {
+	events := []Event{{UID: "fixture"}}
+	modified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	offline := &Cache{}
+	offline.SetEvents(events, modified)
+	got, lastModified, err := offline.Get(time.UTC)
+	if err != nil || fmt.Sprint(uids(got)) != "[fixture]" || lastModified != modified.Unix() {
+		t.Fatalf("got %v, %d, %v without upstream", got, lastModified, err)
+	}
+	if offline.Generation() != 1 {
+		t.Fatalf("got generation %d", offline.Generation())
+	}
+
+	body := testCalendar("a")
+	server, requests := calendarServer(t, &body)
+	for _, static := range []bool{false, true} {
+		clock := newFakeClock()
+		cache := &Cache{Config: Config{URL: server.URL}, Interval: 10 * time.Minute, Static: static}
+		cache.SetClock(clock.Now)
+		cache.SetEvents(events, time.Time{})
+		before := requests.Load()
+		if got := uids(mustGet(t, cache)); fmt.Sprint(got) != "[fixture]" || requests.Load() != before {
+			t.Fatalf("Static=%v: got %v and %d requests before the interval has passed", static, got, requests.Load()-before)
+		}
+		clock.Advance(time.Hour)
+		want := map[bool]string{false: "[a]", true: "[fixture]"}[static]
+		if got := uids(mustGet(t, cache)); fmt.Sprint(got) != want {
+			t.Fatalf("Static=%v: got %v after the interval, want %s", static, got, want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Package icalotel implements icalcache.Tracer with OpenTelemetry. It is a separate package, so the icalcache package does not depend on OpenTelemetry.
+package icalotel
+
+import (
+	"context"
+	"fmt"
+
+	icalcache "github.com/wansing/go-ical-cache"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope of the tracer.
+const ScopeName = "github.com/wansing/go-ical-cache"
+
+// Tracer is an icalcache.Tracer.
+type Tracer struct {
+	Provider trace.TracerProvider // optional, default is the provider of the span in the context, or the global provider if there is none
+}
+
+// New returns a tracer which uses the provider of the span in the context.
+func New() *Tracer {
+	return &Tracer{}
+}
+
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, icalcache.Span) {
+	provider := t.Provider
+	if provider == nil {
+		if parent := trace.SpanFromContext(ctx); parent.SpanContext().IsValid() {
+			provider = parent.TracerProvider()
+		} else {
+			provider = otel.GetTracerProvider()
+		}
+	}
+	ctx, span := provider.Tracer(ScopeName).Start(ctx, name, trace.WithSpanKind(spanKind(name)))
+	return ctx, otelSpan{span}
+}
+
+// spanKind returns SpanKindClient for spans of upstream requests.
+func spanKind(name string) trace.SpanKind {
+	switch name {
+	case "icalcache.Get", "icalcache.ForceRefresh", "icalcache.decode":
+		return trace.SpanKindInternal
+	default:
+		return trace.SpanKindClient
+	}
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+func (s otelSpan) SetAttribute(key string, value any) {
+	switch value := value.(type) {
+	case string:
+		s.span.SetAttributes(attribute.String(key, value))
+	case bool:
+		s.span.SetAttributes(attribute.Bool(key, value))
+	case int:
+		s.span.SetAttributes(attribute.Int(key, value))
+	case int64:
+		s.span.SetAttributes(attribute.Int64(key, value))
+	default:
+		s.span.SetAttributes(attribute.String(key, fmt.Sprint(value)))
+	}
+}
+
+func (s otelSpan) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
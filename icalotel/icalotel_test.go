@@ -0,0 +1,117 @@
+package icalotel
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	icalcache "github.com/wansing/go-ical-cache"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const calendar = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//test//EN\r\n" +
+	"BEGIN:VEVENT\r\nUID:a\r\nDTSTAMP:20240101T000000Z\r\nDTSTART:20240101T100000Z\r\nDTEND:20240101T110000Z\r\nEND:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func newCache(t *testing.T, handler http.HandlerFunc) (*icalcache.Cache, *tracetest.SpanRecorder) {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	cache := &icalcache.Cache{Config: icalcache.Config{URL: server.URL}, Tracer: &Tracer{Provider: provider}}
+	return cache, recorder
+}
+
+func spansByName(recorder *tracetest.SpanRecorder) map[string]sdktrace.ReadOnlySpan {
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	return spans
+}
+
+func TestTracer(t *testing.T) {
+	cache, recorder := newCache(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, calendar)
+	})
+	if _, _, err := cache.Get(time.UTC); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := spansByName(recorder)
+	for name, kind := range map[string]trace.SpanKind{
+		"icalcache.Get":    trace.SpanKindInternal,
+		"icalcache.fetch":  trace.SpanKindClient,
+		"icalcache.GET":    trace.SpanKindClient,
+		"icalcache.decode": trace.SpanKindInternal,
+	} {
+		span, ok := spans[name]
+		if !ok {
+			t.Fatalf("span %s is missing, got %v", name, spans)
+		}
+		if span.SpanKind() != kind {
+			t.Fatalf("span %s has kind %v", name, span.SpanKind())
+		}
+		if span.InstrumentationScope().Name != ScopeName {
+			t.Fatalf("span %s has scope %q", name, span.InstrumentationScope().Name)
+		}
+	}
+	if spans["icalcache.fetch"].Parent().SpanID() != spans["icalcache.Get"].SpanContext().SpanID() {
+		t.Fatal("fetch span is not a child of the Get span")
+	}
+	if spans["icalcache.GET"].Parent().SpanID() != spans["icalcache.fetch"].SpanContext().SpanID() {
+		t.Fatal("GET span is not a child of the fetch span")
+	}
+	var events attribute.Value
+	for _, kv := range spans["icalcache.decode"].Attributes() {
+		if kv.Key == "icalcache.events" {
+			events = kv.Value
+		}
+	}
+	if events.Type() != attribute.INT64 || events.AsInt64() != 1 {
+		t.Fatalf("got icalcache.events %v", events.Emit())
+	}
+}
+
+func TestTracerError(t *testing.T) {
+	cache, recorder := newCache(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+	if _, _, err := cache.Get(time.UTC); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	span := spansByName(recorder)["icalcache.Get"]
+	if span == nil || span.Status().Code != codes.Error {
+		t.Fatalf("got Get span %v", span)
+	}
+	if len(span.Events()) != 1 || span.Events()[0].Name != "exception" {
+		t.Fatalf("error has not been recorded: %v", span.Events())
+	}
+}
+
+func TestTracerParentProvider(t *testing.T) {
+	cache, recorder := newCache(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, calendar)
+	})
+	provider := cache.Tracer.(*Tracer).Provider
+	cache.Tracer = New()
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	if _, _, err := cache.GetContext(ctx, time.UTC); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	span := spansByName(recorder)["icalcache.Get"]
+	if span == nil || span.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Fatalf("Get span does not use the provider and parent of the context: %v", span)
+	}
+}
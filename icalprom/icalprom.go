@@ -0,0 +1,68 @@
+// Package icalprom exports metrics of an icalcache.Cache to Prometheus. It is a separate package, so the icalcache package does not depend on the Prometheus client.
+package icalprom
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	icalcache "github.com/wansing/go-ical-cache"
+)
+
+// Collector is a prometheus.Collector for one cache. Collectors of several caches can be registered together if their names differ.
+type Collector struct {
+	cache    *icalcache.Cache
+	duration *prometheus.HistogramVec
+
+	lastSuccess *prometheus.Desc
+	events      *prometheus.Desc
+	fetchErrors *prometheus.Desc
+	parseErrors *prometheus.Desc
+	bytesRead   *prometheus.Desc
+}
+
+// NewCollector returns a collector whose metrics have the label calendar=name. It observes request durations through cache.OnRequest, calling the previous OnRequest function, so call it before the cache is used.
+func NewCollector(name string, cache *icalcache.Cache) *Collector {
+	labels := prometheus.Labels{"calendar": name}
+	c := &Collector{
+		cache: cache,
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "icalcache_request_duration_seconds",
+			Help:        "Duration of upstream requests, including reading the response body.",
+			ConstLabels: labels,
+		}, []string{"method"}),
+		lastSuccess: prometheus.NewDesc("icalcache_last_success_timestamp_seconds", "Time of the last successful refresh.", nil, labels),
+		events:      prometheus.NewDesc("icalcache_events", "Number of cached events.", nil, labels),
+		fetchErrors: prometheus.NewDesc("icalcache_fetch_errors_total", "Upstream checks which failed before or while reading the body.", nil, labels),
+		parseErrors: prometheus.NewDesc("icalcache_parse_errors_total", "Downloads which could not be parsed.", nil, labels),
+		bytesRead:   prometheus.NewDesc("icalcache_read_bytes_total", "Bytes of upstream bodies, after decompression.", nil, labels),
+	}
+	onRequest := cache.OnRequest
+	cache.OnRequest = func(info icalcache.RequestInfo) {
+		c.duration.WithLabelValues(info.Method).Observe(info.Duration.Seconds())
+		if onRequest != nil {
+			onRequest(info)
+		}
+	}
+	return c
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.duration.Describe(ch)
+	ch <- c.lastSuccess
+	ch <- c.events
+	ch <- c.fetchErrors
+	ch <- c.parseErrors
+	ch <- c.bytesRead
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.duration.Collect(ch)
+	if lastSuccess := c.cache.LastSuccess(); !lastSuccess.IsZero() {
+		ch <- prometheus.MustNewConstMetric(c.lastSuccess, prometheus.GaugeValue, float64(lastSuccess.UnixNano())/float64(time.Second))
+	}
+	ch <- prometheus.MustNewConstMetric(c.events, prometheus.GaugeValue, float64(c.cache.EventCount()))
+	metrics := c.cache.Metrics()
+	ch <- prometheus.MustNewConstMetric(c.fetchErrors, prometheus.CounterValue, float64(metrics.FetchErrors))
+	ch <- prometheus.MustNewConstMetric(c.parseErrors, prometheus.CounterValue, float64(metrics.ParseErrors))
+	ch <- prometheus.MustNewConstMetric(c.bytesRead, prometheus.CounterValue, float64(c.cache.TransferStats().BytesRead))
+}
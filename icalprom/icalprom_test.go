@@ -0,0 +1,70 @@
+package icalprom
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	icalcache "github.com/wansing/go-ical-cache"
+)
+
+const calendar = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//test//EN\r\n" +
+	"BEGIN:VEVENT\r\nUID:a\r\nDTSTAMP:20240101T000000Z\r\nDTSTART:20240101T100000Z\r\nDTEND:20240101T110000Z\r\nEND:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\nUID:b\r\nDTSTAMP:20240101T000000Z\r\nDTSTART:20240102T100000Z\r\nDTEND:20240102T110000Z\r\nEND:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestCollector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, calendar)
+	}))
+	defer server.Close()
+
+	cache := &icalcache.Cache{Config: icalcache.Config{URL: server.URL}}
+	var requests int
+	cache.OnRequest = func(icalcache.RequestInfo) {
+		requests++
+	}
+	collector := NewCollector("test", cache)
+	if _, _, err := cache.Get(time.UTC); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 1 {
+		t.Fatalf("previous OnRequest has been called %d times", requests)
+	}
+
+	if problems, err := testutil.CollectAndLint(collector); err != nil || len(problems) > 0 {
+		t.Fatalf("lint: %v %v", problems, err)
+	}
+	if count := testutil.CollectAndCount(collector, "icalcache_request_duration_seconds"); count != 1 {
+		t.Fatalf("got %d duration series", count)
+	}
+	expected := `
+# HELP icalcache_events Number of cached events.
+# TYPE icalcache_events gauge
+icalcache_events{calendar="test"} 2
+# HELP icalcache_fetch_errors_total Upstream checks which failed before or while reading the body.
+# TYPE icalcache_fetch_errors_total counter
+icalcache_fetch_errors_total{calendar="test"} 0
+# HELP icalcache_read_bytes_total Bytes of upstream bodies, after decompression.
+# TYPE icalcache_read_bytes_total counter
+icalcache_read_bytes_total{calendar="test"} ` + strconv.Itoa(len(calendar)) + `
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "icalcache_events", "icalcache_fetch_errors_total", "icalcache_read_bytes_total"); err != nil {
+		t.Fatal(err)
+	}
+	if count := testutil.CollectAndCount(collector, "icalcache_last_success_timestamp_seconds"); count != 1 {
+		t.Fatalf("got %d last success series", count)
+	}
+}
+
+func TestCollectorBeforeSuccess(t *testing.T) {
+	collector := NewCollector("test", &icalcache.Cache{})
+	if count := testutil.CollectAndCount(collector, "icalcache_last_success_timestamp_seconds"); count != 0 {
+		t.Fatalf("got %d last success series before the first success", count)
+	}
+}
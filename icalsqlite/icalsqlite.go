@@ -0,0 +1,110 @@
+// Package icalsqlite implements icalcache.Store with an SQLite database. It uses database/sql and does not import a driver, so the application can choose one, like modernc.org/sqlite or github.com/mattn/go-sqlite3. Several processes can share a database file, the driver should be configured with a busy timeout then.
+package icalsqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	icalcache "github.com/wansing/go-ical-cache"
+)
+
+// migrations upgrade the schema. The number of applied migrations is stored in PRAGMA user_version, so they must never be changed or reordered, only appended.
+var migrations = []string{
+	`CREATE TABLE calendars (
+		key                TEXT PRIMARY KEY, -- hash of the urls, which can contain credentials
+		events             TEXT NOT NULL,
+		etag               TEXT NOT NULL,
+		http_last_modified TEXT NOT NULL,
+		last_modified      INTEGER NOT NULL,
+		ctag               TEXT NOT NULL,
+		hash_sum           TEXT NOT NULL,
+		location           TEXT NOT NULL,
+		saved              INTEGER NOT NULL
+	)`,
+}
+
+// Store is an icalcache.Store. It is safe for concurrent use by several caches.
+type Store struct {
+	db *sql.DB
+}
+
+// New migrates the schema of db to the current version and returns a store which uses it.
+func New(db *sql.DB) (*Store, error) {
+	if err := migrate(db); err != nil {
+		return nil, fmt.Errorf("migrating sqlite schema: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+func migrate(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var version int
+	if err := tx.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("schema version %d is newer than this package", version)
+	}
+	for ; version < len(migrations); version++ {
+		if _, err := tx.Exec(migrations[version]); err != nil {
+			return fmt.Errorf("migration %d: %w", version+1, err)
+		}
+	}
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil { // PRAGMA doesn't take parameters
+		return err
+	}
+	return tx.Commit()
+}
+
+func (store *Store) Load(key string) ([]icalcache.Event, icalcache.StoreMeta, error) {
+	var data string
+	var meta icalcache.StoreMeta
+	err := store.db.QueryRow(
+		"SELECT events, etag, http_last_modified, last_modified, ctag, hash_sum, location FROM calendars WHERE key = ?",
+		key,
+	).Scan(&data, &meta.ETag, &meta.HTTPLastModified, &meta.LastModified, &meta.CTag, &meta.HashSum, &meta.Location)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, icalcache.StoreMeta{}, icalcache.ErrNotStored
+	}
+	if err != nil {
+		return nil, icalcache.StoreMeta{}, fmt.Errorf("loading calendar: %w", err)
+	}
+	var events []icalcache.Event
+	if err := json.Unmarshal([]byte(data), &events); err != nil {
+		return nil, icalcache.StoreMeta{}, fmt.Errorf("decoding stored events: %w", err)
+	}
+	return events, meta, nil
+}
+
+func (store *Store) Save(key string, events []icalcache.Event, meta icalcache.StoreMeta) error {
+	data, err := json.Marshal(events)
+	if err != nil {
+		return fmt.Errorf("encoding events: %w", err)
+	}
+	_, err = store.db.Exec(
+		`INSERT INTO calendars (key, events, etag, http_last_modified, last_modified, ctag, hash_sum, location, saved)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			events = excluded.events,
+			etag = excluded.etag,
+			http_last_modified = excluded.http_last_modified,
+			last_modified = excluded.last_modified,
+			ctag = excluded.ctag,
+			hash_sum = excluded.hash_sum,
+			location = excluded.location,
+			saved = excluded.saved`,
+		key, string(data), meta.ETag, meta.HTTPLastModified, meta.LastModified, meta.CTag, meta.HashSum, meta.Location, time.Now().Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("saving calendar: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package icalsqlite
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	icalcache "github.com/wansing/go-ical-cache"
+	_ "modernc.org/sqlite"
+)
+
+func openStore(t *testing.T, path string) *Store {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	store, err := New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "calendars.db")
+	store := openStore(t, path)
+	if _, _, err := store.Load("a"); !errors.Is(err, icalcache.ErrNotStored) {
+		t.Fatalf("got %v, want ErrNotStored", err)
+	}
+
+	events := []icalcache.Event{{UID: "1", Summary: "Event", Start: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)}}
+	meta := icalcache.StoreMeta{ETag: `"1"`, LastModified: 1704067200, HashSum: "abc", Location: "UTC"}
+	if err := store.Save("a", events, meta); err != nil {
+		t.Fatal(err)
+	}
+	meta.ETag = `"2"`
+	if err := store.Save("a", events, meta); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save("empty", nil, icalcache.StoreMeta{HashSum: "def"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// reopen, migrations must not run twice
+	store = openStore(t, path)
+	got, gotMeta, err := store.Load("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].UID != "1" || !got[0].Start.Equal(events[0].Start) || gotMeta != meta {
+		t.Fatalf("got %v, %+v", got, gotMeta)
+	}
+	if got, gotMeta, err := store.Load("empty"); err != nil || len(got) != 0 || gotMeta.HashSum != "def" {
+		t.Fatalf("got %v, %+v, %v for the empty calendar", got, gotMeta, err)
+	}
+}
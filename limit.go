@@ -0,0 +1,62 @@
+package icalcache
+
+import (
+	"fmt"
+	"io"
+)
+
+// DefaultMaxBodyBytes is used if Cache.MaxBodyBytes is zero.
+const DefaultMaxBodyBytes = 20 << 20
+
+// BodyTooLargeError is returned if the upstream response exceeds Cache.MaxBodyBytes.
+type BodyTooLargeError struct {
+	Max int64
+}
+
+func (err BodyTooLargeError) Error() string {
+	return fmt.Sprintf("upstream response exceeds %d bytes", err.Max)
+}
+
+// TooManyEventsError is returned if upstream has more events than Cache.MaxEvents.
+type TooManyEventsError struct {
+	Max int
+}
+
+func (err TooManyEventsError) Error() string {
+	return fmt.Sprintf("upstream has more than %d events", err.Max)
+}
+
+func (cache *Cache) maxBodyBytes() int64 {
+	if cache.MaxBodyBytes > 0 {
+		return cache.MaxBodyBytes
+	}
+	return DefaultMaxBodyBytes
+}
+
+// limitReader returns a BodyTooLargeError if more than max bytes are read.
+type limitReader struct {
+	r        io.Reader
+	max      int64
+	n        int64
+	exceeded bool
+	err      error // first read error other than io.EOF, also if the reader's consumer has swallowed it
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.exceeded {
+		return 0, BodyTooLargeError{l.max}
+	}
+	if remaining := l.max - l.n + 1; int64(len(p)) > remaining { // read one byte more than allowed to detect the excess
+		p = p[:remaining]
+	}
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if err != nil && err != io.EOF && l.err == nil {
+		l.err = err
+	}
+	if l.n > l.max {
+		l.exceeded = true
+		return n - int(l.n-l.max), BodyTooLargeError{l.max}
+	}
+	return n, err
+}
@@ -0,0 +1,85 @@
+package icalcache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaxEvents(t *testing.T) {
+	body := testCalendar("a", "b")
+	server, _ := calendarServer(t, &body)
+	cache := &Cache{Config: Config{URL: server.URL}, MaxEvents: 2}
+	mustGet(t, cache)
+
+	body = testCalendar("a", "b", "c")
+	events, _, err := cache.ForceRefresh(time.UTC)
+	var tooMany TooManyEventsError
+	if !errors.As(err, &tooMany) || tooMany.Max != 2 {
+		t.Fatalf("got %v", err)
+	}
+	if got := uids(events); !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("got %v, want the cached events", got)
+	}
+	if cache.Stats().Truncated {
+		t.Fatal("the events are reported as truncated")
+	}
+}
+
+func TestTruncateEvents(t *testing.T) {
+	body := testCalendar("a", "b", "c")
+	server, _ := calendarServer(t, &body)
+	cache := &Cache{Config: Config{URL: server.URL}, MaxEvents: 2, TruncateEvents: true}
+	if got := uids(mustGet(t, cache)); !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("got %v", got)
+	}
+	if !cache.Stats().Truncated {
+		t.Fatal("the events are not reported as truncated")
+	}
+
+	body = testCalendar("a", "b")
+	cache.ForceRefresh(time.UTC)
+	if cache.Stats().Truncated {
+		t.Fatal("the events are still reported as truncated")
+	}
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	body := testCalendar("a")
+	server, _ := calendarServer(t, &body)
+	cache := &Cache{Config: Config{URL: server.URL}, MaxBodyBytes: int64(len(body))}
+	mustGet(t, cache)
+
+	body = strings.Replace(body, "SUMMARY:Event a", "SUMMARY:Event a with a longer summary", 1)
+	events, _, err := cache.ForceRefresh(time.UTC)
+	var tooLarge BodyTooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.Max != int64(len(testCalendar("a"))) {
+		t.Fatalf("got %v", err)
+	}
+	if len(events) != 1 || events[0].Summary != "Event a" {
+		t.Fatalf("got %v, want the cached events", events)
+	}
+}
+
+func TestMaxBodyBytesDecompressed(t *testing.T) {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	io.WriteString(gz, testCalendar("a")+strings.Repeat("\r\n", 1<<20))
+	gz.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(compressed.Bytes())
+	}))
+	defer server.Close()
+	cache := &Cache{Config: Config{URL: server.URL}, MaxBodyBytes: 64 << 10}
+	if _, _, err := cache.Get(time.UTC); !errors.As(err, new(BodyTooLargeError)) {
+		t.Fatalf("got %v for a body of %d compressed bytes", err, compressed.Len())
+	}
+}
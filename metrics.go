@@ -0,0 +1,175 @@
+package icalcache
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics contains cumulative counters about how Get calls have been served.
+type Metrics struct {
+	Hits        int64 // calls which returned the cached events without checking upstream
+	NotModified int64 // upstream checks which found the data not modified, see TransferStats.NotModified
+	Unchanged   int64 // downloads whose hash was unchanged, so the cached events have been kept
+	Parses      int64 // downloads which have been parsed into changed events
+	FetchErrors int64 // upstream checks which failed before or while reading the body
+	ParseErrors int64 // downloads which could not be parsed
+}
+
+type metricsCounters struct {
+	hits        atomic.Int64
+	parses      atomic.Int64
+	fetchErrors atomic.Int64
+	parseErrors atomic.Int64
+}
+
+// Metrics returns the counters. It does not wait for a running refresh.
+func (cache *Cache) Metrics() Metrics {
+	return Metrics{
+		Hits:        cache.metrics.hits.Load(),
+		NotModified: cache.transfer.notModified.Load(),
+		Unchanged:   cache.transfer.unchanged.Load(),
+		Parses:      cache.metrics.parses.Load(),
+		FetchErrors: cache.metrics.fetchErrors.Load(),
+		ParseErrors: cache.metrics.parseErrors.Load(),
+	}
+}
+
+// LastSuccess returns the time of the last successful refresh, or zero.
+func (cache *Cache) LastSuccess() time.Time {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	return cache.lastSuccess
+}
+
+// LastChecked returns when upstream has been checked last, or zero. It never checks upstream.
+func (cache *Cache) LastChecked() time.Time {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	return cache.lastChecked
+}
+
+// ContentLastModified returns the modification time of the cached content as returned by Get, or zero if it is unknown. It never checks upstream.
+func (cache *Cache) ContentLastModified() time.Time {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	if cache.lastModified == 0 {
+		return time.Time{}
+	}
+	return time.Unix(cache.lastModified, 0)
+}
+
+// EventCount returns the number of cached events. It does not wait for a running refresh.
+func (cache *Cache) EventCount() int {
+	if current := cache.current.Load(); current != nil {
+		return len(current.events)
+	}
+	return 0
+}
+
+// ErrStale is matched by a StaleError.
+var ErrStale = errors.New("cached events are stale")
+
+// StaleError is returned instead of the cached events if refreshing has failed for longer than Cache.MaxStale.
+type StaleError struct {
+	Err error         // of the last refresh
+	Age time.Duration // since the last successful refresh, zero if there was none
+}
+
+func (err StaleError) Error() string {
+	if err.Age == 0 {
+		return fmt.Sprintf("no successful refresh: %v", err.Err)
+	}
+	return fmt.Sprintf("cached events are stale for %s: %v", err.Age.Round(time.Second), err.Err)
+}
+
+func (err StaleError) Is(target error) bool {
+	return target == ErrStale
+}
+
+func (err StaleError) Unwrap() error {
+	return err.Err
+}
+
+// checkStale replaces the result of Get by a StaleError if MaxStale is exceeded.
+func (cache *Cache) checkStale(events []Event, lastModified int64, err error) ([]Event, int64, error) {
+	if cache.MaxStale <= 0 {
+		return events, lastModified, err
+	}
+	f := cache.lastError.Load()
+	if f == nil {
+		return events, lastModified, err
+	}
+	var age time.Duration
+	if current := cache.current.Load(); current != nil && !current.lastSuccess.IsZero() {
+		age = cache.now().Sub(current.lastSuccess)
+		if age <= cache.MaxStale {
+			return events, lastModified, err
+		}
+	}
+	return nil, 0, StaleError{f.err, age}
+}
+
+type failure struct {
+	err  error
+	time time.Time
+}
+
+// LastError returns the error of the last refresh and when it occurred, or nil if the last refresh has succeeded. It does not wait for a running refresh.
+func (cache *Cache) LastError() (error, time.Time) {
+	if f := cache.lastError.Load(); f != nil {
+		return f.err, f.time
+	}
+	return nil, time.Time{}
+}
+
+// Stats describes the state of a cache.
+type Stats struct {
+	LastChecked  time.Time // when upstream has been checked last, zero before the first check
+	LastModified time.Time // when the cached content has changed last, zero if unknown
+	LastSuccess  time.Time // of the last successful refresh, zero if there was none
+	Failing      bool      // the last refresh has failed, see LastError
+	Events       int       // number of cached events
+	NextCheck    time.Time // after which Get checks upstream again
+	Generation   uint64    // see Generation
+	Truncated    bool      // events have been dropped because of Cache.MaxEvents and Cache.TruncateEvents
+	CircuitOpen  bool      // upstream is checked only every Cache.BreakerCooldown because of failed refreshes
+}
+
+// Stats returns the state of the cache, taken consistently under the lock. It waits for a running refresh.
+func (cache *Cache) Stats() Stats {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	var lastModified time.Time
+	if cache.lastModified != 0 {
+		lastModified = time.Unix(cache.lastModified, 0)
+	}
+	return Stats{
+		LastChecked:  cache.lastChecked,
+		LastModified: lastModified,
+		LastSuccess:  cache.lastSuccess,
+		Failing:      cache.lastError.Load() != nil,
+		Events:       len(cache.events),
+		NextCheck:    cache.nextCheck(),
+		Generation:   cache.generation.Load(),
+		Truncated:    cache.truncated,
+		CircuitOpen:  cache.circuitOpen(),
+	}
+}
+
+// Warnings returns the EventErrors of the events which have been skipped in the last parse, see SkipInvalidEvents, and of optional properties which have been ignored because they are invalid.
+func (cache *Cache) Warnings() []error {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	return cache.warnings
+}
+
+// Raw returns the body of the last successful download and the modification timestamp of the cached events, which have been parsed from it. It returns nil unless KeepRaw is set. It does not wait for a running refresh.
+func (cache *Cache) Raw() ([]byte, time.Time) {
+	current := cache.current.Load()
+	if current == nil || current.raw == nil {
+		return nil, time.Time{}
+	}
+	return current.raw, time.Unix(current.lastModified, 0)
+}
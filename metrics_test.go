@@ -0,0 +1,182 @@
+package icalcache
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingServer serves a calendar until it is set to fail with 500 Internal Server Error.
+func failingServer(t *testing.T) (*httptest.Server, *atomic.Bool) {
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, testCalendar("a"))
+	}))
+	t.Cleanup(server.Close)
+	return server, &failing
+}
+
+func TestMaxStale(t *testing.T) {
+	server, failing := failingServer(t)
+	clock := newFakeClock()
+	cache := &Cache{Config: Config{URL: server.URL}, Interval: 10 * time.Minute, Retries: -1, MaxStale: time.Hour}
+	cache.SetClock(clock.Now)
+	mustGet(t, cache)
+
+	failing.Store(true)
+	clock.Advance(30 * time.Minute)
+	if events, _, err := cache.Get(time.UTC); len(events) != 1 || errors.Is(err, ErrStale) {
+		t.Fatalf("got %v, %v within MaxStale", events, err)
+	}
+
+	clock.Advance(time.Hour)
+	_, _, err := cache.Get(time.UTC)
+	var stale StaleError
+	if !errors.As(err, &stale) || !errors.Is(err, ErrStale) || stale.Age != 90*time.Minute {
+		t.Fatalf("got %v", err)
+	}
+	var status StatusError
+	if !errors.As(err, &status) || status.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("the StaleError does not wrap the error of the refresh: %v", err)
+	}
+	if events, _, err := cache.Get(time.UTC); events != nil || !errors.Is(err, ErrStale) {
+		t.Fatalf("got %v, %v from memory, want a StaleError as well", events, err)
+	}
+
+	failing.Store(false)
+	clock.Advance(time.Hour)
+	if events := mustGet(t, cache); len(events) != 1 {
+		t.Fatalf("got %v after recovery", events)
+	}
+}
+
+func TestMaxStaleNoSuccess(t *testing.T) {
+	server, failing := failingServer(t)
+	failing.Store(true)
+	cache := &Cache{Config: Config{URL: server.URL}, Retries: -1, MaxStale: time.Hour}
+	_, _, err := cache.Get(time.UTC)
+	var stale StaleError
+	if !errors.As(err, &stale) || stale.Age != 0 {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	var body atomic.Value
+	body.Store(testCalendar("a"))
+	var status atomic.Int64
+	status.Store(http.StatusOK)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if code := int(status.Load()); code != http.StatusOK {
+			w.WriteHeader(code)
+			return
+		}
+		data := body.Load().(string)
+		if data == testCalendar("a") { // with etag
+			if r.Header.Get("If-None-Match") == `"1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"1"`)
+		}
+		io.WriteString(w, data)
+	}))
+	defer server.Close()
+	clock := newFakeClock()
+	cache := &Cache{Config: Config{URL: server.URL}, Interval: 10 * time.Minute, Retries: -1}
+	cache.SetClock(clock.Now)
+	check := func(step string, want Metrics) {
+		t.Helper()
+		if got := cache.Metrics(); got != want {
+			t.Fatalf("%s: got %+v, want %+v", step, got, want)
+		}
+	}
+
+	mustGet(t, cache)
+	mustGet(t, cache)
+	check("hit", Metrics{Hits: 1, Parses: 1})
+	cache.ForceRefresh(time.UTC)
+	check("not modified", Metrics{Hits: 1, Parses: 1, NotModified: 1})
+
+	body.Store(testCalendar("b")) // without etag
+	cache.ForceRefresh(time.UTC)
+	cache.ForceRefresh(time.UTC)
+	check("unchanged", Metrics{Hits: 1, Parses: 2, NotModified: 1, Unchanged: 1})
+
+	status.Store(http.StatusInternalServerError)
+	cache.ForceRefresh(time.UTC)
+	check("fetch error", Metrics{Hits: 1, Parses: 2, NotModified: 1, Unchanged: 1, FetchErrors: 1})
+
+	status.Store(http.StatusOK)
+	body.Store("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:c\r\nDTSTART:invalid\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n")
+	cache.ForceRefresh(time.UTC)
+	check("parse error", Metrics{Hits: 1, Parses: 2, NotModified: 1, Unchanged: 1, FetchErrors: 1, ParseErrors: 1})
+}
+
+func TestStats(t *testing.T) {
+	server, failing := failingServer(t)
+	clock := newFakeClock()
+	cache := &Cache{Config: Config{URL: server.URL}, Interval: 10 * time.Minute, ErrorInterval: time.Minute, Retries: -1}
+	cache.SetClock(clock.Now)
+	if got := cache.Stats(); !got.LastChecked.IsZero() || !got.LastSuccess.IsZero() || got.Events != 0 || got.Failing {
+		t.Fatalf("got %+v before the first refresh", got)
+	}
+
+	mustGet(t, cache)
+	checked := clock.Now()
+	got := cache.Stats()
+	if !got.LastChecked.Equal(checked) || !got.LastSuccess.Equal(checked) || got.Failing || got.Events != 1 || !got.NextCheck.Equal(checked.Add(10*time.Minute)) || got.Generation == 0 || got.CircuitOpen {
+		t.Fatalf("got %+v after the refresh", got)
+	}
+	if got.LastModified.IsZero() {
+		t.Fatalf("got no LastModified")
+	}
+
+	failing.Store(true)
+	clock.Advance(time.Hour)
+	cache.Get(time.UTC)
+	got = cache.Stats()
+	if !got.LastChecked.Equal(clock.Now()) || !got.LastSuccess.Equal(checked) || !got.Failing || got.Events != 1 || !got.NextCheck.Equal(clock.Now().Add(time.Minute)) {
+		t.Fatalf("got %+v after the failed refresh", got)
+	}
+}
+
+func TestAccessors(t *testing.T) {
+	modified := time.Date(2023, 12, 24, 18, 0, 0, 0, time.UTC)
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+		io.WriteString(w, testCalendar("a"))
+	}))
+	defer server.Close()
+	clock := newFakeClock()
+	cache := &Cache{Config: Config{URL: server.URL}}
+	cache.SetClock(clock.Now)
+	if !cache.LastChecked().IsZero() || !cache.ContentLastModified().IsZero() || requests.Load() != 0 {
+		t.Fatal("the accessors are not zero or have checked upstream")
+	}
+
+	_, lastModified, err := cache.Get(time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Hour)
+	if got := cache.LastChecked(); !got.Equal(clock.Now().Add(-time.Hour)) {
+		t.Fatalf("got LastChecked %v", got)
+	}
+	if got := cache.ContentLastModified(); !got.Equal(modified) || got.Unix() != lastModified {
+		t.Fatalf("got ContentLastModified %v, want %v", got, modified)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Fatalf("got %d requests, the accessors have checked upstream", got)
+	}
+}
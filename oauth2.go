@@ -0,0 +1,66 @@
+package icalcache
+
+import (
+	"context"
+	"net/http"
+	"slices"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// OAuth2Config configures the OAuth2 client credentials flow. It is enabled if TokenURL is not empty.
+type OAuth2Config struct {
+	TokenURL     string   `json:"token-url"`
+	ClientID     string   `json:"client-id"`
+	ClientSecret string   `json:"client-secret"`
+	Scopes       []string `json:"scopes"` // optional
+}
+
+func (a OAuth2Config) equal(b OAuth2Config) bool {
+	return a.TokenURL == b.TokenURL && a.ClientID == b.ClientID && a.ClientSecret == b.ClientSecret && slices.Equal(a.Scopes, b.Scopes)
+}
+
+// TokenError is returned if no OAuth2 access token could be obtained.
+type TokenError struct {
+	Err error
+}
+
+func (err TokenError) Error() string {
+	return "getting oauth2 token: " + err.Err.Error()
+}
+
+func (err TokenError) Unwrap() error {
+	return err.Err
+}
+
+// oauth2Token returns a valid access token. The token is cached until shortly before it expires. A new token is requested with ctx, so the token endpoint can't block the caller beyond its deadline or Timeout. The caller must hold the lock.
+func (cache *Cache) oauth2Token(ctx context.Context) (*oauth2.Token, error) {
+	if !cache.tokenConfig.equal(cache.OAuth2) {
+		cache.token = nil
+		cache.tokenConfig = cache.OAuth2
+	}
+	if cache.token.Valid() {
+		return cache.token, nil
+	}
+	client, err := cache.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	ccConfig := &clientcredentials.Config{
+		ClientID:     cache.OAuth2.ClientID,
+		ClientSecret: cache.OAuth2.ClientSecret,
+		TokenURL:     cache.OAuth2.TokenURL,
+		Scopes:       cache.OAuth2.Scopes,
+	}
+	tokenClient := &http.Client{
+		Transport: client.Transport,
+		Timeout:   cache.timeout(),
+	}
+	token, err := ccConfig.Token(context.WithValue(ctx, oauth2.HTTPClient, tokenClient))
+	if err != nil {
+		return nil, TokenError{err}
+	}
+	cache.token = token
+	return token, nil
+}
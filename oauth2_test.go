@@ -0,0 +1,123 @@
+package icalcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tokenServer issues access tokens which expire after expiresIn seconds and serves the calendar to requests which present the last one.
+func tokenServer(t *testing.T, expiresIn int) (*httptest.Server, *atomic.Int64) {
+	var tokens atomic.Int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, _ := r.BasicAuth(); id != "client" || secret != "secret" || r.FormValue("grant_type") != "client_credentials" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"error":"invalid_client"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token%d","token_type":"Bearer","expires_in":%d}`, tokens.Add(1), expiresIn)
+	})
+	mux.HandleFunc("/calendar", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != fmt.Sprintf("Bearer token%d", tokens.Load()) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, testCalendar("a"))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &tokens
+}
+
+func oauth2Cache(server *httptest.Server, secret string) *Cache {
+	return &Cache{Config: Config{
+		URL: server.URL + "/calendar",
+		OAuth2: OAuth2Config{
+			TokenURL:     server.URL + "/token",
+			ClientID:     "client",
+			ClientSecret: secret,
+		},
+	}}
+}
+
+func TestOAuth2TokenCached(t *testing.T) {
+	server, tokens := tokenServer(t, 3600)
+	cache := oauth2Cache(server, "secret")
+	for range 3 {
+		if _, _, err := cache.ForceRefresh(time.UTC); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := tokens.Load(); got != 1 {
+		t.Fatalf("got %d token requests", got)
+	}
+}
+
+func TestOAuth2TokenExpired(t *testing.T) {
+	server, tokens := tokenServer(t, 5) // expires within the safety margin of the oauth2 package
+	cache := oauth2Cache(server, "secret")
+	for range 3 {
+		if _, _, err := cache.ForceRefresh(time.UTC); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := tokens.Load(); got != 3 {
+		t.Fatalf("got %d token requests, want a new token for each request", got)
+	}
+}
+
+func TestOAuth2TokenConfigChanged(t *testing.T) {
+	server, tokens := tokenServer(t, 3600)
+	cache := oauth2Cache(server, "secret")
+	mustGet(t, cache)
+	config := cache.Config
+	config.OAuth2.Scopes = []string{"calendar"}
+	cache.SetConfig(config)
+	mustGet(t, cache)
+	if got := tokens.Load(); got != 2 {
+		t.Fatalf("got %d token requests", got)
+	}
+}
+
+func TestOAuth2TokenError(t *testing.T) {
+	server, tokens := tokenServer(t, 3600)
+	cache := oauth2Cache(server, "wrong")
+	_, _, err := cache.Get(time.UTC)
+	var tokenErr TokenError
+	if !errors.As(err, &tokenErr) {
+		t.Fatalf("got %v, want a TokenError", err)
+	}
+	if tokens.Load() != 0 {
+		t.Fatal("a token has been issued")
+	}
+}
+
+func TestOAuth2TokenContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	cache := oauth2Cache(server, "secret")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, err := cache.GetContext(ctx, time.UTC)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("the token request has ignored the deadline of the context for %v", elapsed)
+	}
+}
@@ -0,0 +1,106 @@
+package icalcache
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// An Option configures a cache in NewCache.
+type Option func(*Cache)
+
+// NewCache returns a cache for config. Like LoadConfig, it moves credentials from the URL into the config before validating it. It also validates the options, so Get fails only because of upstream, unless SetConfig replaces the config later. The options set exported fields of Cache, which must not be changed after NewCache, see Cache. A Cache literal still works, but NewCache is the recommended way.
+func NewCache(config Config, options ...Option) (*Cache, error) {
+	config, err := config.splitUserinfo()
+	if err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	cache := &Cache{Config: config}
+	for _, option := range options {
+		option(cache)
+	}
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	if _, err := cache.checkConfig(); err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+// WithInterval sets Cache.Interval.
+func WithInterval(interval time.Duration) Option {
+	return func(cache *Cache) {
+		cache.Interval = interval
+	}
+}
+
+// WithTimeout sets Cache.Timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(cache *Cache) {
+		cache.Timeout = timeout
+	}
+}
+
+// WithHTTPClient sets Cache.Client.
+func WithHTTPClient(client *http.Client) Option {
+	return func(cache *Cache) {
+		cache.Client = client
+	}
+}
+
+// WithLocation sets the location which Get uses if its defaultLocation is nil, instead of UTC.
+func WithLocation(location *time.Location) Option {
+	return func(cache *Cache) {
+		cache.location = location
+	}
+}
+
+// WithLogger sets Cache.Logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(cache *Cache) {
+		cache.Logger = logger
+	}
+}
+
+// WithMaxBodyBytes sets Cache.MaxBodyBytes.
+func WithMaxBodyBytes(n int64) Option {
+	return func(cache *Cache) {
+		cache.MaxBodyBytes = n
+	}
+}
+
+// WithFetcher sets Cache.Fetcher.
+func WithFetcher(fetcher Fetcher) Option {
+	return func(cache *Cache) {
+		cache.Fetcher = fetcher
+	}
+}
+
+// WithStore sets Cache.Store.
+func WithStore(store Store) Option {
+	return func(cache *Cache) {
+		cache.Store = store
+	}
+}
+
+// WithCacheDir sets Cache.CacheDir.
+func WithCacheDir(dir string) Option {
+	return func(cache *Cache) {
+		cache.CacheDir = dir
+	}
+}
+
+// defaultLocation returns location or, if it is nil, the location of WithLocation or UTC.
+func (cache *Cache) defaultLocation(location *time.Location) *time.Location {
+	switch {
+	case location != nil:
+		return location
+	case cache.location != nil:
+		return cache.location
+	default:
+		return time.UTC
+	}
+}
@@ -0,0 +1,373 @@
+package icalcache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/teambition/rrule-go"
+)
+
+const goodCalendar = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//test//EN\r\n" +
+	"BEGIN:VEVENT\r\nUID:1\r\nDTSTAMP:20240101T000000Z\r\nDTSTART:20240101T100000Z\r\nSUMMARY:First\r\nEND:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\nUID:2\r\nDTSTAMP:20240101T000000Z\r\nDTSTART:20240102T100000Z\r\nSUMMARY:Second\r\nEND:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+// badCalendar has more events than goodCalendar, and the last one is malformed.
+const badCalendar = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//test//EN\r\n" +
+	"BEGIN:VEVENT\r\nUID:3\r\nDTSTAMP:20240101T000000Z\r\nDTSTART:20240103T100000Z\r\nSUMMARY:Third\r\nEND:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\nUID:4\r\nDTSTAMP:20240101T000000Z\r\nDTSTART:20240104T100000Z\r\nSUMMARY:Fourth\r\nEND:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\nUID:5\r\nDTSTAMP:20240101T000000Z\r\nDTSTART:tomorrow\r\nSUMMARY:Malformed\r\nEND:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestMalformedLastEvent(t *testing.T) {
+	var lock sync.Mutex
+	body := goodCalendar
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		io.WriteString(w, body)
+	}))
+	defer server.Close()
+	cache := &Cache{Config: Config{URL: server.URL}}
+
+	check := func(events []Event) {
+		t.Helper()
+		if len(events) != 2 || events[0].UID != "1" || events[0].Summary != "First" || events[1].UID != "2" || events[1].Summary != "Second" {
+			t.Fatalf("got %+v, want the good events", events)
+		}
+	}
+	events, _, err := cache.Get(time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(events)
+
+	lock.Lock()
+	body = badCalendar
+	lock.Unlock()
+	events, _, err = cache.ForceRefresh(time.UTC)
+	if err == nil {
+		t.Fatal("expected error for the malformed event")
+	}
+	check(events)
+	for range 2 { // also after the failed refresh
+		events, _, _ = cache.Get(time.UTC)
+		check(events)
+	}
+}
+
+// parseCalendar returns the events of a calendar with one event which has the given properties.
+func parseCalendar(t *testing.T, props ...string) []Event {
+	t.Helper()
+	body := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//test//EN\r\nBEGIN:VEVENT\r\nUID:1\r\nDTSTAMP:20240101T000000Z\r\nDTSTART:20240101T100000Z\r\n"
+	for _, prop := range props {
+		body += prop + "\r\n"
+	}
+	body += "END:VEVENT\r\nEND:VCALENDAR\r\n"
+	server, _ := calendarServer(t, &body)
+	return mustGet(t, &Cache{Config: Config{URL: server.URL}})
+}
+
+func TestLocation(t *testing.T) {
+	tests := []struct {
+		props []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"LOCATION:Room 1"}, "Room 1"},
+		{[]string{`LOCATION:Room 1\, Building A\nBerlin\; Germany`}, "Room 1, Building A\nBerlin; Germany"},
+		{[]string{`LOCATION:Main Street 1\NBackslash \\`}, "Main Street 1\nBackslash \\"},
+		{[]string{"LOCATION:Conference room on the", " fifth floor"}, "Conference room on thefifth floor"}, // folded
+	}
+	for _, test := range tests {
+		if got := parseCalendar(t, test.props...)[0].Location; got != test.want {
+			t.Errorf("%q: got location %q, want %q", test.props, got, test.want)
+		}
+	}
+}
+
+func TestTransparent(t *testing.T) {
+	tests := []struct {
+		props []string
+		want  bool
+	}{
+		{nil, false},
+		{[]string{"TRANSP:TRANSPARENT"}, true},
+		{[]string{"TRANSP:OPAQUE"}, false},
+		{[]string{"TRANSP:transparent "}, true},
+		{[]string{"X-MICROSOFT-CDO-BUSYSTATUS:FREE"}, true},
+		{[]string{"X-MICROSOFT-CDO-BUSYSTATUS:TENTATIVE"}, false},
+		{[]string{"X-MICROSOFT-CDO-BUSYSTATUS:OOF"}, false},
+		{[]string{"TRANSP:OPAQUE", "X-MICROSOFT-CDO-BUSYSTATUS:FREE"}, false}, // TRANSP takes precedence
+		{[]string{"X-MICROSOFT-CDO-BUSYSTATUS:BUSY", "TRANSP:TRANSPARENT"}, true},
+	}
+	for _, test := range tests {
+		if got := parseCalendar(t, test.props...)[0].Transparent; got != test.want {
+			t.Errorf("%q: got transparent %v, want %v", test.props, got, test.want)
+		}
+	}
+}
+
+func TestExceptionDates(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	events := parseCalendar(t,
+		"RRULE:FREQ=DAILY;COUNT=6",
+		"EXDATE:20240102T100000Z,20240103T100000Z",
+		"EXDATE;TZID=Europe/Berlin:20240105T110000",
+	)
+	want := []time.Time{
+		time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 3, 10, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 5, 11, 0, 0, 0, berlin),
+	}
+	got := events[0].ExceptionDates
+	if len(got) != len(want) {
+		t.Fatalf("got exception dates %v, want %v", got, want)
+	}
+	for i := range want {
+		if !got[i].Equal(want[i]) {
+			t.Fatalf("got exception dates %v, want %v", got, want)
+		}
+	}
+
+	set, err := rrule.StrToRRuleSet(events[0].RecurrenceSet)
+	if err != nil {
+		t.Fatalf("parsing %q: %v", events[0].RecurrenceSet, err)
+	}
+	var days []int
+	for _, occurrence := range set.All() {
+		days = append(days, occurrence.UTC().Day())
+	}
+	if fmt.Sprint(days) != "[1 4 6]" {
+		t.Fatalf("got occurrences on %v from %q", days, events[0].RecurrenceSet)
+	}
+}
+
+func TestSkipInvalidEvents(t *testing.T) {
+	body := badCalendar
+	server, _ := calendarServer(t, &body)
+	cache := &Cache{Config: Config{URL: server.URL}, SkipInvalidEvents: true}
+	events := mustGet(t, cache)
+	if fmt.Sprint(uids(events)) != "[3 4]" {
+		t.Fatalf("got %v, want the valid events", uids(events))
+	}
+	warnings := cache.Warnings()
+	var eventErr EventError
+	if len(warnings) != 1 || !errors.As(warnings[0], &eventErr) || eventErr.UID != "5" {
+		t.Fatalf("got warnings %v", warnings)
+	}
+
+	body = goodCalendar
+	cache.ForceRefresh(time.UTC)
+	if warnings := cache.Warnings(); len(warnings) != 0 {
+		t.Fatalf("got warnings %v after a clean refresh", warnings)
+	}
+}
+
+func TestOrganizer(t *testing.T) {
+	tests := []struct {
+		props []string
+		want  Organizer
+	}{
+		{nil, Organizer{}},
+		{[]string{"ORGANIZER:mailto:alice@example.com"}, Organizer{Email: "alice@example.com"}},
+		{[]string{"ORGANIZER;CN=Alice Example:MAILTO:alice@example.com"}, Organizer{Name: "Alice Example", Email: "alice@example.com"}},
+		{[]string{`ORGANIZER;CN="Example, Alice":mailto:alice%2Bcal@example.com`}, Organizer{Name: "Example, Alice", Email: "alice+cal@example.com"}},
+		{[]string{"ORGANIZER:urn:uuid:f81d4fae-7dec-11d0-a765-00a0c91e6bf6"}, Organizer{URI: "urn:uuid:f81d4fae-7dec-11d0-a765-00a0c91e6bf6"}},
+	}
+	for _, test := range tests {
+		if got := parseCalendar(t, test.props...)[0].Organizer; got != test.want {
+			t.Errorf("%q: got organizer %+v, want %+v", test.props, got, test.want)
+		}
+	}
+}
+
+func TestAttendees(t *testing.T) {
+	tests := []struct {
+		props []string
+		want  []Attendee
+	}{
+		{nil, nil},
+		{[]string{"ATTENDEE:mailto:bob@example.com"}, []Attendee{{Email: "bob@example.com", PartStat: "NEEDS-ACTION", Role: "REQ-PARTICIPANT"}}},
+		{
+			[]string{
+				"ATTENDEE;CN=Bob;PARTSTAT=accepted;ROLE=CHAIR;RSVP=TRUE:mailto:bob@example.com",
+				"ATTENDEE;PARTSTAT=DECLINED;ROLE=OPT-PARTICIPANT;RSVP=false:urn:uuid:1234",
+			},
+			[]Attendee{
+				{Name: "Bob", Email: "bob@example.com", PartStat: "ACCEPTED", Role: "CHAIR", RSVP: true},
+				{URI: "urn:uuid:1234", PartStat: "DECLINED", Role: "OPT-PARTICIPANT"},
+			},
+		},
+	}
+	for _, test := range tests {
+		if got := parseCalendar(t, test.props...)[0].Attendees; !slices.Equal(got, test.want) {
+			t.Errorf("%q: got attendees %+v, want %+v", test.props, got, test.want)
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		props []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"STATUS:CONFIRMED"}, StatusConfirmed},
+		{[]string{"STATUS:tentative "}, StatusTentative},
+		{[]string{"STATUS:CANCELLED"}, StatusCancelled},
+	}
+	for _, test := range tests {
+		if got := parseCalendar(t, test.props...)[0].Status; got != test.want {
+			t.Errorf("%q: got status %q, want %q", test.props, got, test.want)
+		}
+	}
+}
+
+func TestSkipCancelled(t *testing.T) {
+	body := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//test//EN\r\n" +
+		"BEGIN:VEVENT\r\nUID:confirmed\r\nDTSTAMP:20240101T000000Z\r\nDTSTART:20240101T100000Z\r\nSTATUS:CONFIRMED\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:cancelled\r\nDTSTAMP:20240101T000000Z\r\nDTSTART:20240102T100000Z\r\nSTATUS:Cancelled\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:tentative\r\nDTSTAMP:20240101T000000Z\r\nDTSTART:20240103T100000Z\r\nSTATUS:TENTATIVE\r\nEND:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+	server, _ := calendarServer(t, &body)
+	tests := []struct {
+		skip      bool
+		maxEvents int
+		want      string
+	}{
+		{false, 0, "[confirmed cancelled tentative]"},
+		{true, 0, "[confirmed tentative]"},
+		{true, 2, "[confirmed tentative]"}, // dropped events don't count
+	}
+	for _, test := range tests {
+		cache := &Cache{Config: Config{URL: server.URL}, SkipCancelled: test.skip, MaxEvents: test.maxEvents}
+		if got := uids(mustGet(t, cache)); fmt.Sprint(got) != test.want {
+			t.Errorf("SkipCancelled=%v, MaxEvents=%d: got %v, want %s", cache.SkipCancelled, cache.MaxEvents, got, test.want)
+		}
+	}
+}
+
+func TestCategories(t *testing.T) {
+	tests := []struct {
+		props []string
+		want  []string
+	}{
+		{nil, nil},
+		{[]string{"CATEGORIES:Work"}, []string{"Work"}},
+		{[]string{`CATEGORIES:Work\,Shop,Public`}, []string{"Work,Shop", "Public"}},
+		{[]string{"CATEGORIES:Work, Travel ,", "CATEGORIES:Private"}, []string{"Work", "Travel", "Private"}},
+	}
+	for _, test := range tests {
+		if got := parseCalendar(t, test.props...)[0].Categories; !slices.Equal(got, test.want) {
+			t.Errorf("%q: got categories %q, want %q", test.props, got, test.want)
+		}
+	}
+}
+
+func TestGeo(t *testing.T) {
+	tests := []struct {
+		props []string
+		want  *Geo
+	}{
+		{nil, nil},
+		{[]string{"GEO:52.5200;13.4050"}, &Geo{52.52, 13.405}},
+		{[]string{"GEO:-33.8688; 151.2093"}, &Geo{-33.8688, 151.2093}},
+		{[]string{"GEO:91;0"}, nil},
+		{[]string{"GEO:52.52,13.405"}, nil},
+		{[]string{"X-APPLE-STRUCTURED-LOCATION;VALUE=URI:geo:52.52,13.405,34;u=35"}, &Geo{52.52, 13.405}},
+		{[]string{"X-APPLE-STRUCTURED-LOCATION;VALUE=URI:https://example.com/"}, nil},
+		{[]string{"GEO:1;2", "X-APPLE-STRUCTURED-LOCATION;VALUE=URI:geo:3,4"}, &Geo{1, 2}}, // GEO takes precedence
+	}
+	for _, test := range tests {
+		got := parseCalendar(t, test.props...)[0].Geo
+		if (got == nil) != (test.want == nil) || got != nil && *got != *test.want {
+			t.Errorf("%q: got geo %v, want %v", test.props, got, test.want)
+		}
+	}
+}
+
+func TestGeoWarning(t *testing.T) {
+	body := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//test//EN\r\nBEGIN:VEVENT\r\nUID:1\r\nDTSTAMP:20240101T000000Z\r\nDTSTART:20240101T100000Z\r\nGEO:north;east\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	server, _ := calendarServer(t, &body)
+	cache := &Cache{Config: Config{URL: server.URL}}
+	if events := mustGet(t, cache); len(events) != 1 || events[0].Geo != nil {
+		t.Fatalf("got %+v, want the event without geo", events)
+	}
+	var eventErr EventError
+	if warnings := cache.Warnings(); len(warnings) != 1 || !errors.As(warnings[0], &eventErr) || eventErr.UID != "1" {
+		t.Fatalf("got warnings %v", warnings)
+	}
+}
+
+func TestAlarms(t *testing.T) {
+	alarm := func(props ...string) []string {
+		return append(append([]string{"BEGIN:VALARM"}, props...), "END:VALARM")
+	}
+	tests := []struct {
+		props []string
+		want  []Alarm
+	}{
+		{nil, nil},
+		{alarm("ACTION:DISPLAY", "DESCRIPTION:Reminder", "TRIGGER:-PT15M"), []Alarm{{Action: "DISPLAY", Before: 15 * time.Minute, Description: "Reminder"}}},
+		{alarm("ACTION:audio", "TRIGGER;RELATED=END:PT5M"), []Alarm{{Action: "AUDIO", Before: -5 * time.Minute, RelatedEnd: true}}},
+		{alarm("ACTION:EMAIL", "TRIGGER;VALUE=DATE-TIME:20231231T090000Z"), []Alarm{{Action: "EMAIL", Time: time.Date(2023, 12, 31, 9, 0, 0, 0, time.UTC)}}},
+		{alarm("ACTION:DISPLAY"), nil}, // missing trigger
+		{alarm("TRIGGER:-PT15M"), nil}, // missing action
+		{append(alarm("ACTION:DISPLAY", "TRIGGER:-P1D"), alarm("ACTION:DISPLAY", "TRIGGER:soon")...), []Alarm{{Action: "DISPLAY", Before: 24 * time.Hour}}},
+	}
+	for _, test := range tests {
+		if got := parseCalendar(t, test.props...)[0].Alarms; !slices.EqualFunc(got, test.want, alarmEqual) {
+			t.Errorf("%q: got alarms %+v, want %+v", test.props, got, test.want)
+		}
+	}
+}
+
+func TestAlarmAt(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	tests := []struct {
+		alarm Alarm
+		want  time.Time
+	}{
+		{Alarm{Before: 15 * time.Minute}, start.Add(-15 * time.Minute)},
+		{Alarm{Before: -5 * time.Minute, RelatedEnd: true}, end.Add(5 * time.Minute)},
+		{Alarm{Time: start.Add(-24 * time.Hour)}, start.Add(-24 * time.Hour)},
+	}
+	for _, test := range tests {
+		if got := test.alarm.At(start, end); !got.Equal(test.want) {
+			t.Errorf("%+v: got %v, want %v", test.alarm, got, test.want)
+		}
+	}
+}
+
+func TestRevision(t *testing.T) {
+	tests := []struct {
+		props         []string
+		created, last time.Time
+		sequence      int
+	}{
+		{nil, time.Time{}, time.Time{}, 0},
+		{
+			[]string{"CREATED:20231201T080000Z", "LAST-MODIFIED:20231215T093000Z", "SEQUENCE:3"},
+			time.Date(2023, 12, 1, 8, 0, 0, 0, time.UTC), time.Date(2023, 12, 15, 9, 30, 0, 0, time.UTC), 3,
+		},
+		{[]string{"CREATED:yesterday", "LAST-MODIFIED:20231215T093000Z", "SEQUENCE:-1"}, time.Time{}, time.Date(2023, 12, 15, 9, 30, 0, 0, time.UTC), 0}, // invalid values are ignored
+	}
+	for _, test := range tests {
+		event := parseCalendar(t, test.props...)[0]
+		if !event.Created.Equal(test.created) || !event.LastModified.Equal(test.last) || event.Sequence != test.sequence {
+			t.Errorf("%q: got created %v, last modified %v, sequence %d", test.props, event.Created, event.LastModified, event.Sequence)
+		}
+	}
+}
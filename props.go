@@ -0,0 +1,300 @@
+package icalcache
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/teambition/rrule-go"
+)
+
+// Organizer is the ORGANIZER of an event.
+type Organizer struct {
+	Name  string // from the CN parameter, optional
+	Email string // from a mailto URI
+	URI   string // the value if it is not a mailto URI
+}
+
+// calAddress splits a property with a CAL-ADDRESS value, like ORGANIZER or ATTENDEE, into the CN parameter, the email address of a mailto URI, or else the raw value.
+func calAddress(prop *ical.Prop) (name, email, uri string) {
+	name = prop.Params.Get(ical.ParamCommonName)
+	value := strings.TrimSpace(prop.Value)
+	if len(value) >= len("mailto:") && strings.EqualFold(value[:len("mailto:")], "mailto:") {
+		email = value[len("mailto:"):]
+		if unescaped, err := url.PathUnescape(email); err == nil {
+			email = unescaped
+		}
+		return name, email, ""
+	}
+	return name, "", value
+}
+
+func organizer(event ical.Event) Organizer {
+	prop := event.Props.Get(ical.PropOrganizer)
+	if prop == nil {
+		return Organizer{}
+	}
+	name, email, uri := calAddress(prop)
+	return Organizer{name, email, uri}
+}
+
+// Attendee is an ATTENDEE of an event. Missing parameters get their defaults from RFC 5545.
+type Attendee struct {
+	Name     string // from the CN parameter, optional
+	Email    string // from a mailto URI
+	URI      string // the value if it is not a mailto URI
+	PartStat string // like "NEEDS-ACTION" (default), "ACCEPTED", "DECLINED" or "TENTATIVE"
+	Role     string // like "REQ-PARTICIPANT" (default), "OPT-PARTICIPANT", "NON-PARTICIPANT" or "CHAIR"
+	RSVP     bool
+}
+
+// attendees returns nil if the event has no ATTENDEE.
+func attendees(event ical.Event) []Attendee {
+	props := event.Props.Values(ical.PropAttendee)
+	if len(props) == 0 {
+		return nil
+	}
+	attendees := make([]Attendee, 0, len(props))
+	for i := range props {
+		name, email, uri := calAddress(&props[i])
+		attendee := Attendee{
+			Name:     name,
+			Email:    email,
+			URI:      uri,
+			PartStat: strings.ToUpper(props[i].Params.Get(ical.ParamParticipationStatus)),
+			Role:     strings.ToUpper(props[i].Params.Get(ical.ParamRole)),
+			RSVP:     strings.EqualFold(props[i].Params.Get(ical.ParamRSVP), "TRUE"),
+		}
+		if attendee.PartStat == "" {
+			attendee.PartStat = "NEEDS-ACTION"
+		}
+		if attendee.Role == "" {
+			attendee.Role = "REQ-PARTICIPANT"
+		}
+		attendees = append(attendees, attendee)
+	}
+	return attendees
+}
+
+// Values of Event.Status
+const (
+	StatusConfirmed = "CONFIRMED"
+	StatusTentative = "TENTATIVE"
+	StatusCancelled = "CANCELLED"
+)
+
+// categories joins the values of all CATEGORIES properties. It returns nil if there are none.
+func categories(event ical.Event) ([]string, error) {
+	var categories []string
+	for _, prop := range event.Props.Values(ical.PropCategories) {
+		values, err := prop.TextList() // unescapes commas within values
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			if value = strings.TrimSpace(value); value != "" {
+				categories = append(categories, value)
+			}
+		}
+	}
+	return categories, nil
+}
+
+// Geo is a position in degrees.
+type Geo struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// geo parses the GEO property or, if it is missing, a geo URI in X-APPLE-STRUCTURED-LOCATION. It returns nil if neither is present.
+func geo(event ical.Event) (*Geo, error) {
+	if prop := event.Props.Get(ical.PropGeo); prop != nil {
+		lat, lon, ok := strings.Cut(prop.Value, ";")
+		g, err := parseGeo(lat, lon)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("ignoring invalid geo %q", prop.Value)
+		}
+		return g, nil
+	}
+	if prop := event.Props.Get("X-APPLE-STRUCTURED-LOCATION"); prop != nil {
+		value := strings.TrimSpace(prop.Value)
+		if len(value) < len("geo:") || !strings.EqualFold(value[:len("geo:")], "geo:") {
+			return nil, nil
+		}
+		coords, _, _ := strings.Cut(value[len("geo:"):], ";") // drop parameters like u=35
+		lat, lon, ok := strings.Cut(coords, ",")
+		lon, _, _ = strings.Cut(lon, ",") // drop the altitude
+		g, err := parseGeo(lat, lon)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("ignoring invalid geo uri %q", prop.Value)
+		}
+		return g, nil
+	}
+	return nil, nil
+}
+
+func parseGeo(lat, lon string) (*Geo, error) {
+	latitude, err := strconv.ParseFloat(strings.TrimSpace(lat), 64)
+	if err != nil {
+		return nil, err
+	}
+	longitude, err := strconv.ParseFloat(strings.TrimSpace(lon), 64)
+	if err != nil {
+		return nil, err
+	}
+	if latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+		return nil, errors.New("out of range")
+	}
+	return &Geo{latitude, longitude}, nil
+}
+
+// Alarm is a VALARM of an event. Its trigger is either relative to the start or end of the event, or an absolute time.
+type Alarm struct {
+	Action      string        // like "DISPLAY", "AUDIO" or "EMAIL"
+	Before      time.Duration // relative trigger, positive if the alarm is before the start or end
+	RelatedEnd  bool          // relative trigger refers to the end of the event
+	Time        time.Time     // absolute trigger, zero if the trigger is relative
+	Description string
+}
+
+// At returns the time of the alarm for an occurrence which starts at start and ends at end.
+func (alarm Alarm) At(start, end time.Time) time.Time {
+	switch {
+	case !alarm.Time.IsZero():
+		return alarm.Time
+	case alarm.RelatedEnd:
+		return end.Add(-alarm.Before)
+	default:
+		return start.Add(-alarm.Before)
+	}
+}
+
+// alarms returns the valid VALARMs of an event, and an error for each invalid one.
+func alarms(event ical.Event, defaultLocation *time.Location) ([]Alarm, []error) {
+	var alarms []Alarm
+	var errs []error
+	for _, child := range event.Children {
+		if child.Name != ical.CompAlarm {
+			continue
+		}
+		alarm, err := makeAlarm(child, defaultLocation)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ignoring alarm: %w", err))
+			continue
+		}
+		alarms = append(alarms, alarm)
+	}
+	return alarms, errs
+}
+
+func makeAlarm(component *ical.Component, defaultLocation *time.Location) (Alarm, error) {
+	action, err := component.Props.Text(ical.PropAction)
+	if err != nil {
+		return Alarm{}, fmt.Errorf("getting action: %w", err)
+	}
+	action = strings.ToUpper(strings.TrimSpace(action))
+	if action == "" {
+		return Alarm{}, errors.New("missing action")
+	}
+	description, err := component.Props.Text(ical.PropDescription)
+	if err != nil {
+		return Alarm{}, fmt.Errorf("getting description: %w", err)
+	}
+	alarm := Alarm{
+		Action:      action,
+		Description: description,
+	}
+
+	trigger := component.Props.Get(ical.PropTrigger)
+	if trigger == nil {
+		return Alarm{}, errors.New("missing trigger")
+	}
+	if trigger.ValueType() == ical.ValueDateTime {
+		alarm.Time, err = trigger.DateTime(defaultLocation)
+		if err != nil {
+			return Alarm{}, fmt.Errorf("getting trigger: %w", err)
+		}
+		return alarm, nil
+	}
+	duration, err := trigger.Duration()
+	if err != nil {
+		return Alarm{}, fmt.Errorf("getting trigger: %w", err)
+	}
+	alarm.Before = -duration
+	alarm.RelatedEnd = strings.EqualFold(trigger.Params.Get(ical.ParamRelated), "END")
+	return alarm, nil
+}
+
+// transparent reports whether the event does not block time. TRANSP takes precedence over X-MICROSOFT-CDO-BUSYSTATUS, which Outlook sends instead. The default is opaque.
+func transparent(event ical.Event) bool {
+	if prop := event.Props.Get(ical.PropTransparency); prop != nil {
+		return strings.EqualFold(strings.TrimSpace(prop.Value), "TRANSPARENT")
+	}
+	if prop := event.Props.Get("X-MICROSOFT-CDO-BUSYSTATUS"); prop != nil {
+		return strings.EqualFold(strings.TrimSpace(prop.Value), "FREE") // TENTATIVE, BUSY and OOF block time
+	}
+	return false
+}
+
+// timestamp parses a UTC date-time property like CREATED or LAST-MODIFIED. It returns the zero time if the property is absent.
+func timestamp(event ical.Event, name string) (time.Time, error) {
+	prop := event.Props.Get(name)
+	if prop == nil {
+		return time.Time{}, nil
+	}
+	t, err := prop.DateTime(time.UTC)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("ignoring invalid %s %q: %w", strings.ToLower(name), prop.Value, err)
+	}
+	return t, nil
+}
+
+// sequence returns zero if SEQUENCE is absent.
+func sequence(event ical.Event) (int, error) {
+	prop := event.Props.Get(ical.PropSequence)
+	if prop == nil {
+		return 0, nil
+	}
+	seq, err := strconv.Atoi(strings.TrimSpace(prop.Value))
+	if err != nil || seq < 0 {
+		return 0, fmt.Errorf("ignoring invalid sequence %q", prop.Value)
+	}
+	return seq, nil
+}
+
+// exceptionDates parses the values of all EXDATE properties, each of which can hold several comma-separated values. Like the start time, dates are midnight in defaultLocation and date-times use their TZID location, if available.
+func exceptionDates(event ical.Event, defaultLocation *time.Location) ([]time.Time, error) {
+	var dates []time.Time
+	for _, prop := range event.Props.Values(ical.PropExceptionDates) {
+		for _, value := range strings.Split(prop.Value, ",") {
+			single := prop
+			single.Value = strings.TrimSpace(value)
+			date, err := single.DateTime(defaultLocation)
+			if err != nil {
+				return nil, err
+			}
+			dates = append(dates, date)
+		}
+	}
+	return dates, nil
+}
+
+// recurrenceRuleSet returns the recurrence set of the event with the given exception dates, or nil if the event does not recur. It works around go-ical, which fails on EXDATE properties with several values and adds exception dates as RDATE too.
+func recurrenceRuleSet(event ical.Event, exceptionDates []time.Time, defaultLocation *time.Location) (*rrule.Set, error) {
+	props := maps.Clone(event.Props)
+	delete(props, ical.PropExceptionDates)
+	component := &ical.Component{Name: event.Name, Props: props}
+	rs, err := component.RecurrenceSet(defaultLocation)
+	if err != nil || rs == nil {
+		return rs, err
+	}
+	for _, date := range exceptionDates {
+		rs.ExDate(date)
+	}
+	return rs, nil
+}
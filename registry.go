@@ -0,0 +1,116 @@
+package icalcache
+
+import (
+	"encoding/json"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Registry shares caches between parts of an application which use the same calendar, so it is fetched only once per interval. It is safe for concurrent use. The zero value is ready to use.
+type Registry struct {
+	New func(config Config) *Cache // optional, creates and configures a cache, default is a cache with only the config set
+
+	lock   sync.Mutex
+	caches map[string]*Cache // by registryKey
+}
+
+// GetOrCreate returns the cache for config, creating it on the first call. Configs share a cache if they are equal after the URLs have been canonicalized, so configs with the same URL but different credentials get different caches.
+func (registry *Registry) GetOrCreate(config Config) *Cache {
+	key := registryKey(config)
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	if cache, ok := registry.caches[key]; ok {
+		return cache
+	}
+	var cache *Cache
+	if registry.New != nil {
+		cache = registry.New(config)
+	} else {
+		cache = &Cache{Config: config}
+	}
+	if registry.caches == nil {
+		registry.caches = make(map[string]*Cache)
+	}
+	registry.caches[key] = cache
+	return cache
+}
+
+// Caches returns the managed caches, ordered by URL. It waits for running refreshes, because SetConfig can change the URLs meanwhile.
+func (registry *Registry) Caches() []*Cache {
+	type sortable struct {
+		cache *Cache
+		urls  string
+	}
+	registry.lock.Lock()
+	sorted := make([]sortable, 0, len(registry.caches))
+	for _, cache := range registry.caches {
+		sorted = append(sorted, sortable{cache: cache})
+	}
+	registry.lock.Unlock() // don't block GetOrCreate while waiting for refreshes
+	for i, s := range sorted {
+		s.cache.lock.Lock()
+		sorted[i].urls = strings.Join(s.cache.urls(), " ")
+		s.cache.lock.Unlock()
+	}
+	slices.SortFunc(sorted, func(a, b sortable) int {
+		return strings.Compare(a.urls, b.urls)
+	})
+	caches := make([]*Cache, len(sorted))
+	for i := range sorted {
+		caches[i] = sorted[i].cache
+	}
+	return caches
+}
+
+// Close stops the goroutines of all managed caches, see Cache.Stop, and removes the caches from the registry. Subsequent GetOrCreate calls create new caches.
+func (registry *Registry) Close() {
+	registry.lock.Lock()
+	caches := registry.caches
+	registry.caches = nil
+	registry.lock.Unlock()
+	for _, cache := range caches {
+		cache.Stop()
+	}
+}
+
+// registryKey returns the canonicalized config as a string. Credentials from the userinfo part of the URL are moved to the explicit fields, so both notations are equal.
+func registryKey(config Config) string {
+	if split, err := config.splitUserinfo(); err == nil {
+		config = split
+	}
+	config.URL = canonicalURL(config.URL)
+	config.URLs = slices.Clone(config.URLs)
+	for i := range config.URLs {
+		config.URLs[i] = canonicalURL(config.URLs[i])
+	}
+	key, _ := json.Marshal(config) // map keys are sorted
+	return string(key)
+}
+
+// canonicalURL resolves webcal and lowercases the scheme and the host. It removes default ports and the fragment, which is not sent to upstream.
+func canonicalURL(rawURL string) string {
+	u, err := url.Parse(rewriteWebcal(rawURL))
+	if err != nil {
+		return rawURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	host, port := u.Hostname(), u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	u.Host = strings.ToLower(host)
+	if strings.Contains(host, ":") {
+		u.Host = "[" + u.Host + "]" // IPv6
+	}
+	if port != "" {
+		u.Host += ":" + port
+	}
+	if u.Path == "" && u.Host != "" {
+		u.Path = "/"
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String()
+}
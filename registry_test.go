@@ -0,0 +1,66 @@
+package icalcache
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestRegistryCaches(t *testing.T) {
+	var registry Registry
+	b := registry.GetOrCreate(Config{URL: "https://b.example.com/cal.ics"})
+	a := registry.GetOrCreate(Config{URL: "https://a.example.com/cal.ics"})
+	if again := registry.GetOrCreate(Config{URL: "HTTPS://A.example.com:443/cal.ics#fragment"}); again != a {
+		t.Fatal("canonically equal config got another cache")
+	}
+	if other := registry.GetOrCreate(Config{URL: "https://a.example.com/cal.ics", Token: "token"}); other == a {
+		t.Fatal("config with other credentials shares the cache")
+	}
+
+	// sorting reads the urls under the lock of each cache, while SetConfig changes them
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 100 {
+			b.SetConfig(Config{URL: "https://0.example.com/cal.ics"})
+			b.SetConfig(Config{URL: "https://b.example.com/cal.ics"})
+		}
+	}()
+	for range 100 {
+		if caches := registry.Caches(); len(caches) != 3 {
+			t.Fatalf("got %d caches", len(caches))
+		}
+	}
+	wg.Wait()
+	if caches := registry.Caches(); (caches[0] != a && caches[1] != a) || caches[2] != b {
+		t.Fatal("caches are not ordered by url")
+	}
+}
+
+func TestRegistryConcurrent(t *testing.T) {
+	var registry Registry
+	caches := make([]*Cache, 50)
+	var wg sync.WaitGroup
+	for i := range caches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			url := "https://example.com/cal.ics"
+			if i%2 == 1 {
+				url = "webcal://EXAMPLE.com/cal.ics"
+			}
+			caches[i] = registry.GetOrCreate(Config{URL: url})
+		}()
+	}
+	wg.Wait()
+	for i, cache := range caches {
+		if cache != caches[0] {
+			t.Fatalf("call %d got another cache", i)
+		}
+	}
+
+	registry.Close()
+	if cache := registry.GetOrCreate(Config{URL: "https://example.com/cal.ics"}); cache == caches[0] {
+		t.Fatal("Close has not removed the cache")
+	}
+}
@@ -0,0 +1,89 @@
+package icalcache
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DefaultRetries is used if Cache.Retries is zero.
+const DefaultRetries = 2
+
+func (cache *Cache) retries() int {
+	switch {
+	case cache.Retries < 0:
+		return 0
+	case cache.Retries == 0:
+		return DefaultRetries
+	default:
+		return cache.Retries
+	}
+}
+
+// isTransient reports whether a failed request is worth retrying.
+func isTransient(resp *http.Response, err error, now time.Time) bool {
+	if err != nil {
+		if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+			return true
+		}
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsTemporary {
+			return true
+		}
+		return false
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return retryAfter(resp, now).IsZero() // respect Retry-After instead
+	default:
+		return false
+	}
+}
+
+// isStaleConnection reports whether a request failed because upstream closed a reused keep-alive connection.
+func isStaleConnection(err error) bool {
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) ||
+		strings.Contains(err.Error(), "server closed idle connection")
+}
+
+// doFresh sends a clone of req with do. If upstream has closed the connection, it retries once immediately on a fresh connection, regardless of Cache.Retries. The caller must hold the lock.
+func (cache *Cache) doFresh(req *http.Request) (*http.Response, error) {
+	resp, err := cache.do(req.Clone(req.Context()))
+	if err == nil || !isStaleConnection(err) || req.Context().Err() != nil {
+		return resp, err
+	}
+	if client, err := cache.httpClient(); err == nil {
+		client.CloseIdleConnections() // they have likely been closed as well
+	}
+	return cache.do(req.Clone(req.Context()))
+}
+
+// doRetry is like doFresh, but retries transient failures with exponential backoff, starting at 100 milliseconds. Retrying stops when the request context is done. The caller must hold the lock.
+func (cache *Cache) doRetry(req *http.Request) (*http.Response, error) {
+	var backoff = 100 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		resp, err := cache.doFresh(req)
+		if attempt >= cache.retries() || !isTransient(resp, err, cache.now()) {
+			return resp, err
+		}
+		if resp != nil {
+			closeBody(resp.Body)
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			if err == nil {
+				err = checkStatus(resp, cache.now())
+			}
+			return nil, err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
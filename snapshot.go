@@ -0,0 +1,74 @@
+package icalcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// snapshotVersion is incremented on incompatible changes of the snapshot format.
+const snapshotVersion = 1
+
+type snapshot struct {
+	Version      int     `json:"version"`
+	URLsHash     string  `json:"urls-hash"` // not the URLs, because they can contain credentials
+	Events       []Event `json:"events"`
+	LastModified int64   `json:"last-modified"`
+	LastHashSum  string  `json:"last-hash-sum"`
+}
+
+// SnapshotVersionError is returned by LoadSnapshot if the snapshot has been written by an incompatible version of this package.
+type SnapshotVersionError struct {
+	Version int
+}
+
+func (err SnapshotVersionError) Error() string {
+	return fmt.Sprintf("unsupported snapshot version %d, want %d", err.Version, snapshotVersion)
+}
+
+// SaveSnapshot writes the cached events and their modification timestamp as JSON, so they can be restored with LoadSnapshot, for example after a restart. Time zones are saved as offsets only.
+func (cache *Cache) SaveSnapshot(w io.Writer) error {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	return json.NewEncoder(w).Encode(snapshot{
+		Version:      snapshotVersion,
+		URLsHash:     cache.urlsHash(),
+		Events:       cache.events,
+		LastModified: cache.lastModified,
+		LastHashSum:  cache.lastHashSum,
+	})
+}
+
+// LoadSnapshot restores a snapshot which has been written by SaveSnapshot. The events are returned by Get immediately, but the first Get still checks upstream. If the snapshot has another version or has been saved for other URLs, an error is returned and the cache is not modified.
+func (cache *Cache) LoadSnapshot(r io.Reader) error {
+	var s snapshot
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return fmt.Errorf("decoding snapshot: %w", err)
+	}
+	if s.Version != snapshotVersion {
+		return SnapshotVersionError{s.Version}
+	}
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	if s.URLsHash != cache.urlsHash() {
+		return errors.New("snapshot has been saved for other urls")
+	}
+	cache.events = s.Events
+	cache.lastModified = s.LastModified
+	cache.lastHashSum = s.LastHashSum
+	cache.lastContentHash = cache.contentHash(s.Events, s.LastHashSum)
+	cache.raw = nil
+	cache.publish(true)
+	return nil
+}
+
+// urlsHash returns a hex-encoded SHA-256 hash of the URLs, which identifies them in snapshots, CacheDir and Store without revealing credentials.
+func (cache *Cache) urlsHash() string {
+	sum := sha256.Sum256([]byte(strings.Join(cache.urls(), " ")))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,60 @@
+package icalcache
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const snapshotCalendar = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//test//EN\r\n" +
+	"BEGIN:VEVENT\r\nUID:weekly\r\nDTSTAMP:20240101T000000Z\r\nDTSTART:20240101T100000Z\r\nDTEND:20240101T110000Z\r\nRRULE:FREQ=WEEKLY;COUNT=4\r\nEXDATE:20240108T100000Z\r\n" +
+	"SUMMARY:Weekly\r\nLOCATION:Room 1\\, first floor\r\nCATEGORIES:work,team\r\nTRANSP:TRANSPARENT\r\nEND:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\nUID:allday\r\nDTSTAMP:20240101T000000Z\r\nDTSTART;VALUE=DATE:20240105\r\nSUMMARY:All day\r\nEND:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	body := snapshotCalendar
+	server, _ := calendarServer(t, &body)
+	saved := &Cache{Config: Config{URL: server.URL}}
+	want := mustGet(t, saved)
+	var buf bytes.Buffer
+	if err := saved.SaveSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := &Cache{Config: Config{URL: server.URL}}
+	if err := loaded.LoadSnapshot(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.current.Load().events; !eventsEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	if got := mustGet(t, loaded); !eventsEqual(got, want) {
+		t.Fatalf("got %+v after checking upstream, want %+v", got, want)
+	}
+	if generation := loaded.Generation(); generation != 1 {
+		t.Fatalf("got generation %d, the restored events have been replaced by different ones", generation)
+	}
+}
+
+func TestLoadSnapshotErrors(t *testing.T) {
+	body := testCalendar("a")
+	server, _ := calendarServer(t, &body)
+	saved := &Cache{Config: Config{URL: server.URL}}
+	mustGet(t, saved)
+	var buf bytes.Buffer
+	saved.SaveSnapshot(&buf)
+
+	other := &Cache{Config: Config{URL: server.URL + "/other"}}
+	if err := other.LoadSnapshot(bytes.NewReader(buf.Bytes())); err == nil {
+		t.Fatal("snapshot for other urls has been loaded")
+	}
+	var versionErr SnapshotVersionError
+	if err := other.LoadSnapshot(strings.NewReader(`{"version":99}`)); !errors.As(err, &versionErr) || versionErr.Version != 99 {
+		t.Fatalf("got %v", err)
+	}
+	if other.current.Load() != nil {
+		t.Fatal("failed loads have modified the cache")
+	}
+}
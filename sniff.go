@@ -0,0 +1,51 @@
+package icalcache
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// ErrNotICalendar is matched by NotICalendarError.
+var ErrNotICalendar = errors.New("upstream data is not icalendar")
+
+// NotICalendarError is returned if the upstream response does not look like iCalendar data, for example an HTML login page. See Config.SkipContentCheck.
+type NotICalendarError struct {
+	ContentType string
+	Snippet     string // beginning of the body
+}
+
+func (err NotICalendarError) Error() string {
+	return fmt.Sprintf("%v (content type %q): %q", ErrNotICalendar, err.ContentType, err.Snippet)
+}
+
+func (err NotICalendarError) Is(target error) bool {
+	return target == ErrNotICalendar
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// sniffICalendar checks that body starts with BEGIN:VCALENDAR, after an optional byte order mark and whitespace. An empty body is accepted. The returned body must be used instead of the passed one.
+func sniffICalendar(body io.ReadCloser, contentType string) (io.ReadCloser, error) {
+	br := bufio.NewReaderSize(body, 512)
+	start, _ := br.Peek(512)
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(start, []byte("\xef\xbb\xbf")), " \t\r\n")
+	const begin = "BEGIN:VCALENDAR"
+	if len(trimmed) > 0 && (len(trimmed) < len(begin) || !bytes.EqualFold(trimmed[:len(begin)], []byte(begin))) {
+		snippet := start[:min(len(start), 200)]
+		for len(snippet) > 0 && !utf8.Valid(snippet) { // don't cut multi-byte characters
+			snippet = snippet[:len(snippet)-1]
+		}
+		return nil, NotICalendarError{
+			ContentType: contentType,
+			Snippet:     string(snippet),
+		}
+	}
+	return readCloser{br, body}, nil
+}
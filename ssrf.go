@@ -0,0 +1,46 @@
+package icalcache
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+)
+
+// addressClass returns a description of the class of addr if it is not a public address.
+func addressClass(addr netip.Addr) (string, bool) {
+	addr = addr.Unmap()
+	switch {
+	case addr.IsLoopback():
+		return "loopback", true
+	case addr.IsLinkLocalUnicast(), addr.IsLinkLocalMulticast():
+		return "link-local", true
+	case addr.IsPrivate():
+		if addr.Is4() {
+			return "private", true
+		}
+		return "unique-local", true
+	case addr.IsUnspecified():
+		return "unspecified", true
+	case addr.IsMulticast():
+		return "multicast", true
+	default:
+		return "", false
+	}
+}
+
+// blockPrivateAddresses is a net.Dialer Control function. It runs after name resolution for every connection, so it also covers redirects and DNS rebinding. It would only see the address of a proxy or unix socket, so checkConfig rejects them.
+func blockPrivateAddresses(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if class, blocked := addressClass(addr); blocked {
+		return fmt.Errorf("blocked connection to %s address %s", class, addr)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package icalcache
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAddressClass(t *testing.T) {
+	tests := []struct {
+		addr  string
+		class string
+	}{
+		{"127.0.0.1", "loopback"},
+		{"::1", "loopback"},
+		{"169.254.169.254", "link-local"},
+		{"fe80::1", "link-local"},
+		{"10.0.0.1", "private"},
+		{"172.16.0.1", "private"},
+		{"192.168.1.1", "private"},
+		{"fd00::1", "unique-local"},
+		{"::ffff:10.0.0.1", "private"},
+		{"0.0.0.0", "unspecified"},
+		{"239.1.1.1", "multicast"},
+		{"93.184.216.34", ""},
+		{"2606:2800:220:1::", ""},
+	}
+	for _, test := range tests {
+		class, blocked := addressClass(netip.MustParseAddr(test.addr))
+		if class != test.class || blocked != (test.class != "") {
+			t.Errorf("%s: got %q %v, want %q", test.addr, class, blocked, test.class)
+		}
+	}
+}
+
+func TestBlockPrivateAddresses(t *testing.T) {
+	if err := blockPrivateAddresses("tcp", "93.184.216.34:443", nil); err != nil {
+		t.Fatalf("public address: %v", err)
+	}
+	if err := blockPrivateAddresses("tcp", "10.1.2.3:443", nil); err == nil || !strings.Contains(err.Error(), "private") {
+		t.Fatalf("private address: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, testCalendar("a"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{"loopback", Config{URL: server.URL}},
+		{"host override", Config{URL: "http://calendar.example.com/", HostOverride: map[string]string{"calendar.example.com": server.Listener.Addr().String()}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			allowed := &Cache{Config: test.config}
+			if _, _, err := allowed.Get(time.UTC); err != nil {
+				t.Fatalf("without BlockPrivateAddresses: %v", err)
+			}
+			blocked := &Cache{Config: test.config, BlockPrivateAddresses: true, Retries: -1}
+			if _, _, err := blocked.Get(time.UTC); err == nil || !strings.Contains(err.Error(), "blocked connection to loopback address") {
+				t.Fatalf("got %v", err)
+			}
+		})
+	}
+}
+
+func TestBlockPrivateAddressesUnsupported(t *testing.T) {
+	tests := []Config{
+		{URL: "https://calendar.example.com/", ProxyURL: "http://proxy.example.com:3128"},
+		{URL: "http://calendar.example.com/", UnixSocket: "/run/calendar.sock"},
+	}
+	for _, config := range tests {
+		if _, err := NewCache(config, func(cache *Cache) { cache.BlockPrivateAddresses = true }); err == nil {
+			t.Errorf("NewCache %+v: expected error", config)
+		}
+		cache := &Cache{Config: config, BlockPrivateAddresses: true}
+		if _, _, err := cache.Get(time.UTC); err == nil || !strings.Contains(err.Error(), "not supported") {
+			t.Errorf("Get %+v: got %v", config, err)
+		}
+		if err := cache.Check(context.Background()); err == nil {
+			t.Errorf("Check %+v: expected error", config)
+		}
+	}
+}
+
+func TestBlockFileURLs(t *testing.T) {
+	cache := &Cache{Config: Config{URL: "file:///etc/passwd"}, BlockPrivateAddresses: true}
+	if _, _, err := cache.Get(time.UTC); err == nil || !strings.Contains(err.Error(), "file urls are blocked") {
+		t.Fatalf("got %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package icalcache
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrNotStored is returned by Store.Load if nothing has been saved for the url.
+var ErrNotStored = errors.New("calendar not stored")
+
+// StoreMeta is the fetch state which a Store keeps along with the events.
+type StoreMeta struct {
+	ETag             string // of the last successful GET
+	HTTPLastModified string // Last-Modified header of the last successful GET
+	LastModified     int64  // as returned by Get
+	CTag             string // of the CalDAV collection
+	HashSum          string // of the upstream data
+	Location         string // name of the defaultLocation which the events have been parsed with
+}
+
+// Store persists events across restarts and processes. The key is a hash of the upstream URLs, not the URLs, because they can contain credentials. Implementations must be safe for concurrent use if they are shared by several caches. See the icalsqlite package for an implementation.
+type Store interface {
+	Load(key string) ([]Event, StoreMeta, error) // returns ErrNotStored if nothing has been saved
+	Save(key string, events []Event, meta StoreMeta) error
+}
+
+// restore loads the events and validators from CacheDir or Store. It reports whether they have been loaded. The caller must hold the lock.
+func (cache *Cache) restore(defaultLocation *time.Location) bool {
+	if cache.CacheDir != "" && cache.loadDiskCache(defaultLocation) {
+		return true
+	}
+	return cache.loadStore(defaultLocation)
+}
+
+// loadStore loads the events and validators from Store. Errors are ignored, then the cache starts empty. The caller must hold the lock.
+func (cache *Cache) loadStore(defaultLocation *time.Location) bool {
+	if cache.Store == nil {
+		return false
+	}
+	events, meta, err := cache.Store.Load(cache.urlsHash())
+	if err != nil {
+		if !errors.Is(err, ErrNotStored) && cache.Logger != nil {
+			cache.Logger.Warn("loading from store", "error", err)
+		}
+		return false
+	}
+	if meta.Location != defaultLocation.String() {
+		return false // floating times would differ
+	}
+
+	cache.events = events
+	cache.warnings = nil
+	cache.raw = nil // KeepRaw is fulfilled with the next download
+	cache.lastHashSum = meta.HashSum
+	cache.lastContentHash = cache.contentHash(events, meta.HashSum)
+	cache.lastLocation = meta.Location
+	cache.lastModified = meta.LastModified
+	cache.lastURL = strings.Join(cache.urls(), " ") // keep the validators in refresh
+	cache.lastETag = meta.ETag
+	cache.lastHTTPLastModified = meta.HTTPLastModified
+	cache.lastCTag = meta.CTag
+	return true
+}
+
+// saveStore writes the events and validators to Store. Errors are only logged, because the store is an optimization. The caller must hold the lock.
+func (cache *Cache) saveStore(defaultLocation *time.Location) {
+	if cache.Store == nil {
+		return
+	}
+	err := cache.Store.Save(cache.urlsHash(), cache.events, StoreMeta{
+		ETag:             cache.lastETag,
+		HTTPLastModified: cache.lastHTTPLastModified,
+		LastModified:     cache.lastModified,
+		CTag:             cache.lastCTag,
+		HashSum:          cache.lastHashSum,
+		Location:         defaultLocation.String(),
+	})
+	if err != nil && cache.Logger != nil {
+		cache.Logger.Warn("saving to store", "error", err)
+	}
+}
@@ -0,0 +1,106 @@
+package icalcache
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// memoryStore is a Store in memory.
+type memoryStore struct {
+	lock   sync.Mutex
+	events map[string][]Event
+	meta   map[string]StoreMeta
+}
+
+func (store *memoryStore) Load(key string) ([]Event, StoreMeta, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	events, ok := store.events[key]
+	if !ok {
+		return nil, StoreMeta{}, ErrNotStored
+	}
+	return events, store.meta[key], nil
+}
+
+func (store *memoryStore) Save(key string, events []Event, meta StoreMeta) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if store.events == nil {
+		store.events = make(map[string][]Event)
+		store.meta = make(map[string]StoreMeta)
+	}
+	store.events[key] = events
+	store.meta[key] = meta
+	return nil
+}
+
+func TestStore(t *testing.T) {
+	var gets atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		gets.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		io.WriteString(w, testCalendar("a", "b"))
+	}))
+	defer server.Close()
+
+	store := &memoryStore{}
+	config := Config{URL: strings.Replace(server.URL, "http://", "http://user:secret@", 1)}
+	mustGet(t, &Cache{Config: config, Store: store})
+
+	restarted := &Cache{Config: config, Store: store}
+	if events := mustGet(t, restarted); len(events) != 2 {
+		t.Fatalf("got %v", uids(events))
+	}
+	if gets.Load() != 1 {
+		t.Fatalf("got %d downloads", gets.Load())
+	}
+	for key := range store.events {
+		if strings.Contains(key, "secret") || strings.Contains(key, server.Listener.Addr().String()) {
+			t.Fatalf("the store key %q contains the url", key)
+		}
+	}
+}
+
+func TestStoreEmpty(t *testing.T) {
+	body := testCalendar("a")
+	var gets atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := fmt.Sprintf(`"%d"`, len(body))
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		gets.Add(1)
+		io.WriteString(w, body)
+	}))
+	defer server.Close()
+
+	store := &memoryStore{}
+	config := Config{URL: server.URL}
+	cache := &Cache{Config: config, Store: store}
+	mustGet(t, cache)
+	body = ""
+	if _, _, err := cache.ForceRefresh(time.UTC); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := &Cache{Config: config, Store: store}
+	if events := mustGet(t, restarted); len(events) != 0 {
+		t.Fatalf("the restarted cache has restored the deleted events %v", uids(events))
+	}
+	if gets.Load() != 2 {
+		t.Fatalf("got %d downloads, want the restarted cache to revalidate the stored empty calendar", gets.Load())
+	}
+}
@@ -0,0 +1,50 @@
+package icalcache
+
+import (
+	"context"
+	"net/url"
+)
+
+// Tracer starts spans for Get calls and the phases of a refresh: fetch (with HEAD and GET requests as children) and decode. The parent span is taken from the context. See the icalotel package for an OpenTelemetry implementation.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is started by a Tracer.
+type Span interface {
+	SetAttribute(key string, value any) // value is a string, bool, int or int64
+	End(err error)                      // err is nil on success
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, any) {}
+func (noopSpan) End(error)                {}
+
+func (cache *Cache) startSpan(ctx context.Context, name string) (context.Context, Span) {
+	if cache.Tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return cache.Tracer.Start(ctx, name)
+}
+
+// getSpan is the span of a Get call.
+type getSpan struct {
+	Span
+}
+
+// end ends the span with the results of the Get call and passes them through.
+func (span getSpan) end(events []Event, lastModified int64, err error) ([]Event, int64, error) {
+	span.SetAttribute("icalcache.events", len(events))
+	span.End(err)
+	return events, lastModified, err
+}
+
+// hostname returns the host of rawURL without the port, or an empty string.
+func hostname(rawURL string) string {
+	u, err := url.Parse(rewriteWebcal(rawURL))
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
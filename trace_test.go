@@ -0,0 +1,96 @@
+package icalcache
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingTracer records the names and attributes of the spans.
+type recordingTracer struct {
+	lock  sync.Mutex
+	spans []*recordedSpan
+}
+
+type recordedSpan struct {
+	name       string
+	attributes map[string]any
+	ended      bool
+	err        error
+}
+
+func (tracer *recordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+	span := &recordedSpan{name: name, attributes: make(map[string]any)}
+	tracer.spans = append(tracer.spans, span)
+	return ctx, span
+}
+
+func (tracer *recordingTracer) names() []string {
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+	var names []string
+	for _, span := range tracer.spans {
+		names = append(names, span.name)
+	}
+	return names
+}
+
+func (span *recordedSpan) SetAttribute(key string, value any) {
+	span.attributes[key] = value
+}
+
+func (span *recordedSpan) End(err error) {
+	span.ended = true
+	span.err = err
+}
+
+func TestTracer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, testCalendar("a", "b"))
+	}))
+	defer server.Close()
+
+	tracer := &recordingTracer{}
+	cache := &Cache{Config: Config{URL: server.URL}, Tracer: tracer}
+	mustGet(t, cache)
+
+	want := []string{"icalcache.Get", "icalcache.fetch", "icalcache.GET", "icalcache.decode"}
+	if got := tracer.names(); !slices.Equal(got, want) {
+		t.Fatalf("got spans %v, want %v", got, want)
+	}
+	for _, span := range tracer.spans {
+		if !span.ended || span.err != nil {
+			t.Fatalf("span %s: ended %v, error %v", span.name, span.ended, span.err)
+		}
+	}
+	if got := tracer.spans[1].attributes["server.address"]; got != "127.0.0.1" {
+		t.Fatalf("got server.address %v", got)
+	}
+	if got := tracer.spans[3].attributes["icalcache.events"]; got != 2 {
+		t.Fatalf("got icalcache.events %v", got)
+	}
+}
+
+func TestTracerFetcherOnly(t *testing.T) {
+	tracer := &recordingTracer{}
+	cache := &Cache{
+		Fetcher: FetcherFunc(func(ctx context.Context) (io.ReadCloser, time.Time, bool, error) {
+			return io.NopCloser(strings.NewReader(testCalendar("a"))), time.Time{}, false, nil
+		}),
+		Tracer: tracer,
+	}
+	if events := mustGet(t, cache); len(events) != 1 {
+		t.Fatalf("got %d events", len(events))
+	}
+	if _, ok := tracer.spans[1].attributes["server.address"]; ok {
+		t.Fatal("server.address has been set without a url")
+	}
+}
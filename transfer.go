@@ -0,0 +1,34 @@
+package icalcache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// TransferStats contains cumulative counters about the upstream traffic of a cache.
+type TransferStats struct {
+	BytesRead         int64         // of upstream bodies, after decompression
+	Downloads         int64         // refreshes which read a body from upstream
+	Unchanged         int64         // downloads whose hash was unchanged
+	NotModified       int64         // refreshes which skipped the download, because of a 304 response, a HEAD request, the CTag or a modification timestamp which is not newer
+	LastFetchDuration time.Duration // of the last refresh, including reading and parsing the body
+}
+
+type transferCounters struct {
+	bytesRead         atomic.Int64
+	downloads         atomic.Int64
+	unchanged         atomic.Int64
+	notModified       atomic.Int64
+	lastFetchDuration atomic.Int64
+}
+
+// TransferStats returns the transfer counters. It does not wait for a running refresh.
+func (cache *Cache) TransferStats() TransferStats {
+	return TransferStats{
+		BytesRead:         cache.transfer.bytesRead.Load(),
+		Downloads:         cache.transfer.downloads.Load(),
+		Unchanged:         cache.transfer.unchanged.Load(),
+		NotModified:       cache.transfer.notModified.Load(),
+		LastFetchDuration: time.Duration(cache.transfer.lastFetchDuration.Load()),
+	}
+}
@@ -0,0 +1,43 @@
+package icalcache
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTransferStats(t *testing.T) {
+	body := testCalendar("a")
+	var etag atomic.Bool
+	etag.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		if etag.Load() {
+			if r.Header.Get("If-None-Match") == `"1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"1"`)
+		}
+		io.WriteString(w, body)
+	}))
+	defer server.Close()
+	cache := &Cache{Config: Config{URL: server.URL}}
+
+	mustGet(t, cache)
+	if got := cache.TransferStats(); got.BytesRead != int64(len(body)) || got.Downloads != 1 || got.Unchanged != 0 || got.NotModified != 0 || got.LastFetchDuration < 5*time.Millisecond {
+		t.Fatalf("got %+v after the download", got)
+	}
+	cache.ForceRefresh(time.UTC)
+	if got := cache.TransferStats(); got.BytesRead != int64(len(body)) || got.Downloads != 1 || got.NotModified != 1 {
+		t.Fatalf("got %+v after the not modified response", got)
+	}
+	etag.Store(false)
+	cache.ForceRefresh(time.UTC)
+	if got := cache.TransferStats(); got.BytesRead != 2*int64(len(body)) || got.Downloads != 2 || got.Unchanged != 1 || got.NotModified != 1 {
+		t.Fatalf("got %+v after the unchanged download", got)
+	}
+}
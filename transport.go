@@ -0,0 +1,300 @@
+package icalcache
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"time"
+)
+
+// default clients, shared among all caches which don't need their own transport
+var (
+	client, _         = transportConfig{}.newClient()
+	insecureClient, _ = transportConfig{SkipTLSVerify: true}.newClient()
+)
+
+// transportConfig contains the Config fields which affect the http.Transport.
+type transportConfig struct {
+	SkipTLSVerify bool
+	ProxyURL      string
+	CAFile        string
+	CAPEM         string
+
+	ClientCertFile string
+	ClientKeyFile  string
+	ClientCertPEM  string
+	ClientKeyPEM   string
+
+	MinTLSVersion string
+	NoRedirects   bool
+	Cookies       bool
+
+	HostOverride string // encoded, see encodeHostOverride
+	UnixSocket   string
+
+	BlockPrivateAddresses bool          // from Cache
+	Resolver              *net.Resolver // from Cache
+	Pool                  PoolConfig    // from Cache
+}
+
+// PoolConfig tunes the connection pool of an http.Transport. Zero values keep the defaults of the http package.
+type PoolConfig struct {
+	MaxIdleConns        int           // zero means no limit
+	MaxIdleConnsPerHost int           // default is http.DefaultMaxIdleConnsPerHost
+	IdleConnTimeout     time.Duration // zero means no limit
+	ForceAttemptHTTP2   bool          // else HTTP/2 is not used, because the transport has a custom TLS config and dialer
+}
+
+// NewSharedTransport returns a transport with the default settings of this package and the given pool settings. Use it in the Client of many caches which request the same host, so they share one connection pool. Config fields which affect the transport, like ProxyURL or CAFile, have no effect then.
+func NewSharedTransport(pool PoolConfig) *http.Transport {
+	transport, _ := transportConfig{Pool: pool}.newTransport() // never returns an error for these settings
+	return transport
+}
+
+func (config Config) transportConfig() transportConfig {
+	return transportConfig{
+		SkipTLSVerify: config.SkipTLSVerify,
+		ProxyURL:      config.ProxyURL,
+		HostOverride:  encodeHostOverride(config.HostOverride),
+		UnixSocket:    config.UnixSocket,
+		CAFile:        config.CAFile,
+		CAPEM:         config.CAPEM,
+
+		ClientCertFile: config.ClientCertFile,
+		ClientKeyFile:  config.ClientKeyFile,
+		ClientCertPEM:  config.ClientCertPEM,
+		ClientKeyPEM:   config.ClientKeyPEM,
+
+		MinTLSVersion: config.MinTLSVersion,
+		NoRedirects:   config.NoRedirects,
+		Cookies:       config.Cookies,
+	}
+}
+
+// newClient returns a client without timeout. Timeouts are applied per request, see Cache.Timeout.
+func (tc transportConfig) newClient() (*http.Client, error) {
+	transport, err := tc.newTransport()
+	if err != nil {
+		return nil, err
+	}
+	c := &http.Client{
+		Transport:     transport,
+		CheckRedirect: checkRedirect(tc.NoRedirects),
+	}
+	if tc.Cookies {
+		c.Jar, _ = cookiejar.New(nil) // never returns an error
+	}
+	return c, nil
+}
+
+func (tc transportConfig) newTransport() (*http.Transport, error) {
+	if tc.BlockPrivateAddresses && (tc.ProxyURL != "" || tc.UnixSocket != "") {
+		return nil, errors.New("blocking private addresses is not supported with a proxy or unix socket")
+	}
+	minVersion, err := parseTLSVersion(tc.MinTLSVersion)
+	if err != nil {
+		return nil, err
+	}
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: tc.SkipTLSVerify,
+			MinVersion:         minVersion,
+		},
+		MaxIdleConns:        tc.Pool.MaxIdleConns,
+		MaxIdleConnsPerHost: tc.Pool.MaxIdleConnsPerHost,
+		IdleConnTimeout:     tc.Pool.IdleConnTimeout,
+		ForceAttemptHTTP2:   tc.Pool.ForceAttemptHTTP2,
+	}
+	transport.DialContext = tc.dialContext()
+	if tc.CAFile != "" || tc.CAPEM != "" {
+		pool, err := tc.certPool()
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+	if tc.hasClientCert() {
+		cert, err := tc.clientCert()
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+	if tc.ProxyURL != "" {
+		proxyURL, err := parseProxyURL(tc.ProxyURL)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL) // the http package supports socks5 and socks5h, including username and password in the url
+	}
+	return transport, nil
+}
+
+// maxRedirects is the maximum length of a redirect chain.
+const maxRedirects = 5
+
+// checkRedirect returns a redirect policy which caps the number of redirects, detects loops and drops the Authorization header if a redirect changes the host or downgrades to http.
+func checkRedirect(noRedirects bool) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		hop := len(via)
+		if noRedirects {
+			return fmt.Errorf("redirect %d to %s: redirects are disabled", hop, req.URL.Redacted())
+		}
+		if hop > maxRedirects {
+			return fmt.Errorf("redirect %d to %s: stopped after %d redirects", hop, req.URL.Redacted(), maxRedirects)
+		}
+		for _, prev := range via {
+			if prev.URL.String() == req.URL.String() {
+				return fmt.Errorf("redirect %d to %s: redirect loop", hop, req.URL.Redacted())
+			}
+		}
+		orig := via[0].URL
+		if req.URL.Host != orig.Host || (orig.Scheme == "https" && req.URL.Scheme != "https") {
+			req.Header.Del("Authorization")
+		}
+		return nil
+	}
+}
+
+// certPool returns a pool which contains the certificates from CAFile and CAPEM only.
+func (tc transportConfig) certPool() (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if tc.CAFile != "" {
+		pem, err := os.ReadFile(tc.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading ca file: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ca file %s", tc.CAFile)
+		}
+	}
+	if tc.CAPEM != "" {
+		if !pool.AppendCertsFromPEM([]byte(tc.CAPEM)) {
+			return nil, errors.New("no certificates found in ca pem")
+		}
+	}
+	return pool, nil
+}
+
+func (tc transportConfig) hasClientCert() bool {
+	return tc.ClientCertFile != "" || tc.ClientKeyFile != "" || tc.ClientCertPEM != "" || tc.ClientKeyPEM != ""
+}
+
+// clientCert loads the TLS client certificate from either files or inline PEM.
+func (tc transportConfig) clientCert() (tls.Certificate, error) {
+	switch {
+	case tc.ClientCertFile != "" && tc.ClientKeyFile != "":
+		cert, err := tls.LoadX509KeyPair(tc.ClientCertFile, tc.ClientKeyFile)
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("loading client certificate: %w", err)
+		}
+		return cert, nil
+	case tc.ClientCertPEM != "" && tc.ClientKeyPEM != "":
+		cert, err := tls.X509KeyPair([]byte(tc.ClientCertPEM), []byte(tc.ClientKeyPEM))
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("parsing client certificate: %w", err)
+		}
+		return cert, nil
+	default:
+		return tls.Certificate{}, errors.New("client certificate requires both cert and key, either as files or as pem")
+	}
+}
+
+// ProxyError is returned if the proxy can't be reached. Errors which the proxy reports about the calendar host are not wrapped in it.
+type ProxyError struct {
+	Err error
+}
+
+func (err ProxyError) Error() string {
+	return "reaching proxy: " + err.Err.Error()
+}
+
+func (err ProxyError) Unwrap() error {
+	return err.Err
+}
+
+// wrapTransportError makes failures to reach the proxy and handshake failures due to a rejected client certificate recognizable.
+func wrapTransportError(err error) error {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && (opErr.Op == "proxyconnect" || opErr.Op == "socks connect") {
+		var dialErr *net.OpError
+		if errors.As(opErr.Err, &dialErr) && dialErr.Op == "dial" {
+			return ProxyError{err}
+		}
+	}
+	var alert tls.AlertError
+	if errors.As(err, &alert) {
+		switch alert {
+		case 42, 48, 116: // bad_certificate, unknown_ca, certificate_required
+			return fmt.Errorf("client certificate rejected by upstream: %w", err)
+		}
+	}
+	return err
+}
+
+// parseTLSVersion returns zero (the Go default) for an empty string.
+func parseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "":
+		return 0, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unknown tls version: %s", version)
+	}
+}
+
+func parseProxyURL(rawURL string) (*url.URL, error) {
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing proxy url: %w", err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return proxyURL, nil
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme: %s", proxyURL.Scheme)
+	}
+}
+
+// httpClient returns Cache.Client, a shared default client or a client which has been created for the config of the cache. The caller must hold the lock.
+func (cache *Cache) httpClient() (*http.Client, error) {
+	if cache.Client != nil {
+		return cache.Client, nil
+	}
+	tc := cache.Config.transportConfig()
+	tc.BlockPrivateAddresses = cache.BlockPrivateAddresses
+	tc.Resolver = cache.Resolver
+	tc.Pool = cache.Pool
+	switch tc {
+	case transportConfig{}:
+		return client, nil
+	case transportConfig{SkipTLSVerify: true}:
+		return insecureClient, nil
+	default:
+		if cache.client == nil || cache.clientConfig != tc {
+			c, err := tc.newClient()
+			if err != nil {
+				return nil, err
+			}
+			if cache.client != nil {
+				cache.client.CloseIdleConnections()
+			}
+			cache.client = c
+			cache.clientConfig = tc
+		}
+		return cache.client, nil
+	}
+}
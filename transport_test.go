@@ -0,0 +1,277 @@
+package icalcache
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// taggingTransport marks its requests with a header.
+type taggingTransport struct {
+	tag string
+}
+
+func (transport taggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("X-Client", transport.tag)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestCustomClients(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, testCalendar(r.Header.Get("X-Client")))
+	}))
+	defer server.Close()
+
+	a := &Cache{Config: Config{URL: server.URL}, Client: &http.Client{Transport: taggingTransport{"a"}}}
+	b := &Cache{Config: Config{URL: server.URL}, Client: &http.Client{Transport: taggingTransport{"b"}}}
+	plain := &Cache{Config: Config{URL: server.URL}}
+	for _, test := range []struct {
+		cache *Cache
+		want  string
+	}{{a, "a"}, {b, "b"}, {plain, ""}, {a, "a"}} {
+		events, _, err := test.cache.ForceRefresh(time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if events[0].UID != test.want {
+			t.Fatalf("got request from client %q, want %q", events[0].UID, test.want)
+		}
+	}
+}
+
+func TestRedirects(t *testing.T) {
+	var lock sync.Mutex
+	authorization := make(map[string]string) // by server
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		authorization["target"] = r.Header.Get("Authorization")
+		lock.Unlock()
+		io.WriteString(w, testCalendar("a"))
+	}))
+	defer target.Close()
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/same":
+			http.Redirect(w, r, "/cal", http.StatusFound)
+		case r.URL.Path == "/cross":
+			http.Redirect(w, r, target.URL+"/cal", http.StatusFound)
+		case r.URL.Path == "/loop":
+			http.Redirect(w, r, "/loop2", http.StatusFound)
+		case r.URL.Path == "/loop2":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case strings.HasPrefix(r.URL.Path, "/hop"):
+			http.Redirect(w, r, r.URL.Path+"x", http.StatusFound)
+		default:
+			lock.Lock()
+			authorization["origin"] = r.Header.Get("Authorization")
+			lock.Unlock()
+			io.WriteString(w, testCalendar("a"))
+		}
+	}))
+	defer origin.Close()
+	config := Config{Username: "alice", Password: "secret"}
+
+	config.URL = origin.URL + "/same"
+	mustGet(t, &Cache{Config: config})
+	if authorization["origin"] == "" {
+		t.Error("same host redirect has dropped the Authorization header")
+	}
+	config.URL = origin.URL + "/cross"
+	mustGet(t, &Cache{Config: config})
+	if authorization["target"] != "" {
+		t.Error("cross host redirect has kept the Authorization header")
+	}
+
+	for path, want := range map[string]string{"/loop": "redirect loop", "/hop": "stopped after 5 redirects"} {
+		config.URL = origin.URL + path
+		if _, _, err := (&Cache{Config: config}).Get(time.UTC); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got error %v, want %q", path, err, want)
+		}
+	}
+}
+
+func TestProxyURL(t *testing.T) {
+	var lock sync.Mutex
+	var hosts []string
+	var proxyAuth string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		hosts = append(hosts, r.URL.Host)
+		proxyAuth = r.Header.Get("Proxy-Authorization")
+		lock.Unlock()
+		io.WriteString(w, testCalendar("a"))
+	}))
+	defer proxy.Close()
+
+	proxyURL := strings.Replace(proxy.URL, "http://", "http://user:pass@", 1)
+	cache := &Cache{Config: Config{URL: "http://calendar.invalid/cal.ics", ProxyURL: proxyURL}}
+	if events := mustGet(t, cache); len(events) != 1 {
+		t.Fatalf("got %v", events)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(hosts) != 1 || hosts[0] != "calendar.invalid" || !strings.HasPrefix(proxyAuth, "Basic ") {
+		t.Fatalf("the proxy got hosts %v and Proxy-Authorization %q", hosts, proxyAuth)
+	}
+
+	for _, invalid := range []string{"ftp://proxy.invalid", "://"} {
+		if _, err := NewCache(Config{URL: "http://calendar.invalid/", ProxyURL: invalid}); err == nil {
+			t.Errorf("NewCache has accepted proxy url %q", invalid)
+		}
+	}
+}
+
+func certificatePEM(cert []byte) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}))
+}
+
+func TestCAPEM(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, testCalendar("a"))
+	}))
+	defer server.Close()
+
+	if _, _, err := (&Cache{Config: Config{URL: server.URL}, Retries: -1}).Get(time.UTC); err == nil {
+		t.Fatal("the self-signed certificate has been accepted without CA")
+	}
+	cache := &Cache{Config: Config{URL: server.URL, CAPEM: certificatePEM(server.Certificate().Raw)}}
+	if events := mustGet(t, cache); len(events) != 1 {
+		t.Fatalf("got %v", events)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(caFile, []byte(certificatePEM(server.Certificate().Raw)), 0o600)
+	if events := mustGet(t, &Cache{Config: Config{URL: server.URL, CAFile: caFile}}); len(events) != 1 {
+		t.Fatalf("got %v with CAFile", events)
+	}
+	if _, err := NewCache(Config{URL: server.URL, CAPEM: "not a certificate"}); err == nil {
+		t.Fatal("NewCache has accepted an invalid CA")
+	}
+}
+
+// clientCertificate returns a self-signed client certificate and its key in PEM format.
+func clientCertificate(t *testing.T) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "icalcache test client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, certificatePEM(der), string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+}
+
+func TestClientCertificate(t *testing.T) {
+	cert, certPEM, keyPEM := clientCertificate(t)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, testCalendar(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	server.StartTLS()
+	defer server.Close()
+	caPEM := certificatePEM(server.Certificate().Raw)
+
+	if _, _, err := (&Cache{Config: Config{URL: server.URL, CAPEM: caPEM}, Retries: -1}).Get(time.UTC); err == nil {
+		t.Fatal("the server has accepted a request without client certificate")
+	}
+	cache := &Cache{Config: Config{URL: server.URL, CAPEM: caPEM, ClientCertPEM: certPEM, ClientKeyPEM: keyPEM}}
+	if events := mustGet(t, cache); len(events) != 1 || events[0].UID != "icalcache test client" {
+		t.Fatalf("got %v", events)
+	}
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "cert.pem"), []byte(certPEM), 0o600)
+	os.WriteFile(filepath.Join(dir, "key.pem"), []byte(keyPEM), 0o600)
+	cache = &Cache{Config: Config{URL: server.URL, CAPEM: caPEM, ClientCertFile: filepath.Join(dir, "cert.pem"), ClientKeyFile: filepath.Join(dir, "key.pem")}}
+	if events := mustGet(t, cache); len(events) != 1 {
+		t.Fatalf("got %v with files", events)
+	}
+	if _, err := NewCache(Config{URL: server.URL, ClientCertPEM: certPEM}); err == nil {
+		t.Fatal("NewCache has accepted a client certificate without key")
+	}
+}
+
+func TestMinTLSVersion(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, testCalendar("a"))
+	}))
+	server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+	caPEM := certificatePEM(server.Certificate().Raw)
+
+	cache := &Cache{Config: Config{URL: server.URL, CAPEM: caPEM, MinTLSVersion: "1.3"}, Retries: -1}
+	if _, _, err := cache.Get(time.UTC); err == nil {
+		t.Fatal("TLS 1.2 has been accepted with MinTLSVersion 1.3")
+	}
+	cache = &Cache{Config: Config{URL: server.URL, CAPEM: caPEM, MinTLSVersion: "1.2"}}
+	if events := mustGet(t, cache); len(events) != 1 {
+		t.Fatalf("got %v", events)
+	}
+	if _, err := NewCache(Config{URL: server.URL, MinTLSVersion: "1.4"}); err == nil {
+		t.Fatal("NewCache has accepted an unknown tls version")
+	}
+}
+
+func TestCookies(t *testing.T) {
+	for _, cookies := range []bool{true, false} {
+		var sessions []string
+		var mu sync.Mutex
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			cookie, err := r.Cookie("session")
+			if err != nil {
+				http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", Path: "/"})
+				sessions = append(sessions, "")
+			} else {
+				sessions = append(sessions, cookie.Value)
+			}
+			io.WriteString(w, testCalendar("a"))
+		}))
+		cache := &Cache{Config: Config{URL: server.URL, Cookies: cookies}}
+		mustGet(t, cache)
+		if _, _, err := cache.ForceRefresh(time.UTC); err != nil {
+			t.Fatal(err)
+		}
+		server.Close()
+		want := ""
+		if cookies {
+			want = "s1"
+		}
+		if len(sessions) != 2 || sessions[0] != "" || sessions[1] != want {
+			t.Fatalf("cookies %t: got sessions %q", cookies, sessions)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package icalcache
+
+import (
+	"errors"
+	"net/url"
+)
+
+// splitUserinfo moves credentials from the userinfo part of config.URL to Username and Password. It fails if they conflict with the explicit fields.
+func (config Config) splitUserinfo() (Config, error) {
+	u, err := url.Parse(rewriteWebcal(config.URL))
+	if err != nil || u.User == nil {
+		return config, nil // errors are reported when the request is made
+	}
+	username := u.User.Username()
+	password, _ := u.User.Password()
+	if config.Username != "" && config.Username != username {
+		return config, errors.New("username in url differs from username field")
+	}
+	if config.Password != "" && password != "" && config.Password != password {
+		return config, errors.New("password in url differs from password field")
+	}
+	config.Username = username
+	if password != "" {
+		config.Password = password
+	}
+	u.User = nil
+	config.URL = u.String()
+	return config, nil
+}
@@ -0,0 +1,80 @@
+package icalcache
+
+import (
+	"context"
+	"slices"
+)
+
+// Update is sent to watchers, see Watch.
+type Update struct {
+	Events       []Event
+	LastModified int64
+	Generation   uint64 // see Cache.Generation
+}
+
+type watcher struct {
+	ch      chan Update
+	changes uint64 // changes which have been sent
+}
+
+// Watch returns a channel which receives the cached events once initially, if there are any, and then whenever a refresh has found new upstream data, like OnChange. Updates are sent in order, and an update is never older than the ones received before. Watch does not trigger refreshes, use Start or call Get. If the receiver is slow, only the latest update is kept. The channel is closed when ctx is done.
+func (cache *Cache) Watch(ctx context.Context) (<-chan Update, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	w := &watcher{ch: make(chan Update, 1)}
+
+	cache.watchLock.Lock()
+	cache.watchers = append(cache.watchers, w)
+	if current := cache.current.Load(); current != nil {
+		w.changes = current.changes // pending changes are older
+		send(w.ch, Update{current.events, current.lastModified, current.generation})
+	}
+	cache.watchLock.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		cache.watchLock.Lock()
+		cache.watchers = slices.DeleteFunc(cache.watchers, func(other *watcher) bool {
+			return other == w
+		})
+		close(w.ch)
+		cache.watchLock.Unlock()
+	}()
+	return w.ch, nil
+}
+
+// deliver calls OnChange and notifies watchers for the pending changes, unless another goroutine is already delivering them.
+func (cache *Cache) deliver() {
+	cache.watchLock.Lock()
+	defer cache.watchLock.Unlock()
+	if cache.delivering {
+		return // it will pick up our change
+	}
+	cache.delivering = true
+	for len(cache.pending) > 0 {
+		changed := cache.pending[0]
+		cache.pending = cache.pending[1:]
+		for _, w := range cache.watchers {
+			if changed.seq > w.changes {
+				w.changes = changed.seq
+				send(w.ch, Update{changed.new, changed.lastModified, changed.generation})
+			}
+		}
+		if cache.OnChange != nil {
+			cache.watchLock.Unlock()
+			cache.OnChange(changed.old, changed.new)
+			cache.watchLock.Lock()
+		}
+	}
+	cache.delivering = false
+}
+
+// send replaces an update which has not been received yet. The caller must hold the watchLock, so it is the only sender.
+func send(ch chan Update, update Update) {
+	select {
+	case <-ch:
+	default:
+	}
+	ch <- update
+}
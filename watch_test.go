@@ -0,0 +1,166 @@
+package icalcache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// changingServer serves a different calendar on each request.
+func changingServer(t *testing.T) *httptest.Server {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testCalendar(strconv.FormatInt(requests.Add(1), 10))))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOnChangeInOrder(t *testing.T) {
+	server := changingServer(t)
+	var running atomic.Int32
+	var calls int
+	var last []Event
+	cache := &Cache{Config: Config{URL: server.URL}}
+	cache.OnChange = func(old, new []Event) {
+		if running.Add(1) > 1 {
+			t.Error("OnChange runs concurrently")
+		}
+		defer running.Add(-1)
+		if calls > 0 && !eventsEqual(old, last) {
+			t.Errorf("old is %v, previous new was %v", uids(old), uids(last))
+		}
+		calls++
+		last = new
+		cache.Generation() // can call methods of the cache
+		time.Sleep(time.Millisecond)
+	}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 10 {
+				if _, _, err := cache.ForceRefresh(time.UTC); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 80 {
+		t.Fatalf("got %d calls, want 80", calls)
+	}
+	if events := mustGet(t, cache); !eventsEqual(events, last) {
+		t.Fatalf("last call got %v, cache has %v", uids(last), uids(events))
+	}
+}
+
+func TestWatchInOrder(t *testing.T) {
+	server := changingServer(t)
+	cache := &Cache{Config: Config{URL: server.URL}}
+	mustGet(t, cache)
+	ctx, cancel := context.WithCancel(context.Background())
+	updates, err := cache.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var generation uint64
+		for update := range updates {
+			if update.Generation < generation {
+				t.Errorf("got generation %d after %d", update.Generation, generation)
+			}
+			generation = update.Generation
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 10 {
+				cache.ForceRefresh(time.UTC)
+			}
+		}()
+	}
+	wg.Wait()
+	cancel()
+	<-done
+}
+
+func TestWatchInitial(t *testing.T) {
+	server := changingServer(t)
+	cache := &Cache{Config: Config{URL: server.URL}}
+	mustGet(t, cache)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates, err := cache.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update := <-updates; update.Generation != 1 || len(update.Events) != 1 || update.Events[0].UID != "1" {
+		t.Fatalf("got %+v", update)
+	}
+	cache.ForceRefresh(time.UTC)
+	if update := <-updates; update.Generation != 2 || update.Events[0].UID != "2" {
+		t.Fatalf("got %+v", update)
+	}
+}
+
+func TestOnChangeEmpty(t *testing.T) {
+	body := testCalendar("a")
+	server, _ := calendarServer(t, &body)
+	var calls [][]Event
+	cache := &Cache{Config: Config{URL: server.URL}, OnChange: func(old, new []Event) { calls = append(calls, new) }}
+	mustGet(t, cache)
+
+	body = ""
+	if events, _, err := cache.ForceRefresh(time.UTC); err != nil || len(events) != 0 {
+		t.Fatalf("got %v, %v", uids(events), err)
+	}
+	if len(calls) != 2 || len(calls[1]) != 0 {
+		t.Fatalf("got OnChange calls %v", calls)
+	}
+	cache.ForceRefresh(time.UTC)
+	if len(calls) != 2 {
+		t.Fatalf("OnChange has been called again for the same empty body")
+	}
+}
+
+func TestWatchEmpty(t *testing.T) {
+	body := testCalendar("a")
+	server, _ := calendarServer(t, &body)
+	cache := &Cache{Config: Config{URL: server.URL}}
+	mustGet(t, cache)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates, err := cache.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update := <-updates; len(update.Events) != 1 {
+		t.Fatalf("got %+v", update)
+	}
+
+	body = ""
+	cache.ForceRefresh(time.UTC)
+	select {
+	case update := <-updates:
+		if len(update.Events) != 0 || update.Generation != 2 {
+			t.Fatalf("got %+v", update)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no update for the empty calendar")
+	}
+}